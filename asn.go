@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ipInfo describes who announces an IP address.
+type ipInfo struct {
+	IP      string `json:"ip"`
+	ASN     uint32 `json:"asn,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	ASName  string `json:"as_name,omitempty"`
+	Country string `json:"country,omitempty"`
+	Source  string `json:"source,omitempty"` // cymru or mmdb
+	Error   string `json:"error,omitempty"`
+}
+
+func (i ipInfo) String() string {
+	if i.Error != "" {
+		return "eigenaar onbekend (" + i.Error + ")"
+	}
+	parts := []string{fmt.Sprintf("AS%d", i.ASN)}
+	if i.ASName != "" {
+		parts[0] += " " + i.ASName
+	}
+	if i.Prefix != "" {
+		parts = append(parts, i.Prefix)
+	}
+	if i.Country != "" {
+		parts = append(parts, i.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type ipEnricher interface {
+	lookupIP(ctx context.Context, ip string) ipInfo
+}
+
+// newIPEnricher returns nil when enrichment is not requested. An mmdb file
+// wins over the Team Cymru DNS service, so it also works offline.
+func newIPEnricher(o options, client *dns.Client, resolver string) (ipEnricher, error) {
+	if o.asnDB != "" {
+		db, err := maxminddb.Open(o.asnDB)
+		if err != nil {
+			return nil, fmt.Errorf("asn database: %w", err)
+		}
+		return &mmdbEnricher{db: db}, nil
+	}
+	if o.asn {
+		return &cymruEnricher{client: client, resolver: resolver, names: map[uint32]string{}}, nil
+	}
+	return nil, nil
+}
+
+// cymruEnricher uses the Team Cymru IP-to-ASN DNS interface:
+//
+//	4.3.2.1.origin.asn.cymru.com TXT "15169 | 8.8.8.0/24 | US | arin | 2023-12-28"
+//	AS15169.asn.cymru.com        TXT "15169 | US | arin | 2000-03-30 | GOOGLE, US"
+type cymruEnricher struct {
+	client   *dns.Client
+	resolver string
+
+	mu    sync.Mutex
+	names map[uint32]string
+}
+
+func (c *cymruEnricher) lookupIP(ctx context.Context, ip string) ipInfo {
+	info := ipInfo{IP: ip, Source: "cymru"}
+
+	rev, err := dns.ReverseAddr(ip)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	var qname string
+	switch {
+	case strings.HasSuffix(rev, ".in-addr.arpa."):
+		qname = strings.TrimSuffix(rev, "in-addr.arpa.") + "origin.asn.cymru.com"
+	default:
+		qname = strings.TrimSuffix(rev, "ip6.arpa.") + "origin6.asn.cymru.com"
+	}
+
+	fields, err := c.txtFields(ctx, qname)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if len(fields) < 3 {
+		info.Error = "niet geannonceerd"
+		return info
+	}
+	// Multi-origin prefixes list several ASNs; the first one is fine here.
+	origins := strings.Fields(fields[0])
+	if len(origins) == 0 {
+		info.Error = "ongeldig antwoord: geen ASN"
+		return info
+	}
+	asn, err := strconv.ParseUint(origins[0], 10, 32)
+	if err != nil {
+		info.Error = "ongeldig antwoord: " + fields[0]
+		return info
+	}
+	info.ASN = uint32(asn)
+	info.Prefix = fields[1]
+	info.Country = fields[2]
+	info.ASName = c.asName(ctx, info.ASN)
+	return info
+}
+
+func (c *cymruEnricher) asName(ctx context.Context, asn uint32) string {
+	c.mu.Lock()
+	name, ok := c.names[asn]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	fields, err := c.txtFields(ctx, fmt.Sprintf("AS%d.asn.cymru.com", asn))
+	if err == nil && len(fields) >= 5 {
+		name = fields[4]
+	}
+	c.mu.Lock()
+	c.names[asn] = name
+	c.mu.Unlock()
+	return name
+}
+
+func (c *cymruEnricher) txtFields(ctx context.Context, qname string) ([]string, error) {
+	rrs, err := queryType(ctx, c.client, c.resolver, qname, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range rrs {
+		t, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(strings.Join(t.Txt, ""), "|")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts, nil
+	}
+	return nil, nil
+}
+
+// mmdbEnricher reads a MaxMind GeoLite2/GeoIP2 ASN database or an IPinfo
+// ASN/country_asn database. Both layouts are decoded into one record.
+type mmdbEnricher struct {
+	db *maxminddb.Reader
+}
+
+type mmdbRecord struct {
+	// MaxMind GeoLite2-ASN
+	ASNumber uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg    string `maxminddb:"autonomous_system_organization"`
+
+	// IPinfo ("AS13335", "Cloudflare, Inc.")
+	ASN    string `maxminddb:"asn"`
+	ASName string `maxminddb:"as_name"`
+
+	// A plain ISO code (IPinfo) or a {"iso_code": ...} map (MaxMind).
+	Country any `maxminddb:"country"`
+}
+
+func (m *mmdbEnricher) lookupIP(_ context.Context, ip string) ipInfo {
+	info := ipInfo{IP: ip, Source: "mmdb"}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		info.Error = "ongeldig IP"
+		return info
+	}
+	var rec mmdbRecord
+	network, ok, err := m.db.LookupNetwork(addr, &rec)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if !ok {
+		info.Error = "niet in database"
+		return info
+	}
+
+	info.Prefix = network.String()
+	info.ASN = rec.ASNumber
+	info.ASName = rec.ASOrg
+	if info.ASN == 0 && rec.ASN != "" {
+		if n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(rec.ASN), "AS"), 10, 32); err == nil {
+			info.ASN = uint32(n)
+		}
+		info.ASName = rec.ASName
+	}
+	switch c := rec.Country.(type) {
+	case string:
+		info.Country = c
+	case map[string]any:
+		info.Country, _ = c["iso_code"].(string)
+	}
+	if info.ASN == 0 {
+		info.Error = "geen ASN in database record"
+	}
+	return info
+}
+
+// enrichIPs looks up each unique IP once, in input order.
+func enrichIPs(ctx context.Context, e ipEnricher, ips []string) []ipInfo {
+	if e == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []ipInfo
+	for _, ip := range ips {
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		out = append(out, e.lookupIP(ctx, ip))
+	}
+	return out
+}
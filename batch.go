@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// batchResult is one finished domain, in the order workers complete them.
+type batchResult struct {
+	report   *dnsReport
+	failures []string
+}
+
+// runBatch runs the selected checks for every domain in -f (or stdin with
+// -d -) on a pool of workers and streams one result per domain to stdout.
+// Failed domains are summarised on stderr and optionally written to
+// -failed-out, so a rerun with -f on that file picks up where this one
+// failed. The exit code follows the same scheme as a single domain, over
+// all domains together.
+func runBatch(client *dns.Client, resolver string, o options, srvCatalogue []srvService, enricher ipEnricher) int {
+	if o.format != "jsonl" && o.format != "csv" {
+		fmt.Fprintf(os.Stderr, "error: onbekend formaat %q (jsonl of csv)\n", o.format)
+		return exitUsage
+	}
+	if o.workers < 1 {
+		o.workers = 1
+	}
+
+	var in io.Reader = os.Stdin
+	if o.file != "" && o.file != "-" {
+		f, err := os.Open(o.file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		in = f
+	}
+	domains, err := readDomainList(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	if len(domains) == 0 {
+		fmt.Fprintf(os.Stderr, "error: geen domeinen opgegeven\n")
+		return exitUsage
+	}
+
+	var w batchWriter
+	if o.format == "csv" {
+		if w, err = newCSVBatchWriter(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitFindings
+		}
+	} else {
+		w = &jsonlBatchWriter{enc: json.NewEncoder(os.Stdout)}
+	}
+
+	// Cancelling stops the feeder and the running lookups; results must
+	// still be drained so no worker stays blocked on a send.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jobs := make(chan string)
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				rctx, rcancel := context.WithTimeout(ctx, runTimeout(o))
+				r := buildReport(rctx, client, resolver, d, o, srvCatalogue, enricher)
+				rcancel()
+				results <- batchResult{report: r, failures: r.failures()}
+			}
+		}()
+	}
+	go func() {
+	feed:
+		for _, d := range domains {
+			select {
+			case jobs <- d:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	abort := func() int {
+		cancel()
+		for range results {
+		}
+		return exitFindings
+	}
+
+	var failed []string
+	var st runStatus
+	done := 0
+	for res := range results {
+		done++
+		st.reportChecks(res.report, o.warnDays)
+		if len(res.failures) > 0 {
+			failed = append(failed, res.report.Domain)
+		}
+		if err := w.write(res); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return abort()
+		}
+	}
+	if err := w.flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFindings
+	}
+
+	fmt.Fprintf(os.Stderr, "\nbatch klaar: %d domeinen, %d ok, %d mislukt\n", done, done-len(failed), len(failed))
+	if len(failed) == 0 {
+		return st.exitCode(o.strict)
+	}
+	for _, d := range failed {
+		fmt.Fprintf(os.Stderr, "  [!] %s\n", d)
+	}
+	if o.failed != "" {
+		if err := os.WriteFile(o.failed, []byte(strings.Join(failed, "\n")+"\n"), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "mislukte domeinen opgeslagen in %s (hervat met -f %s)\n", o.failed, o.failed)
+		}
+	}
+	return st.exitCode(o.strict)
+}
+
+// readDomainList reads one domain per line; empty lines, '#' comments and
+// duplicates are skipped.
+func readDomainList(r io.Reader) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		d := normalizeDomain(line)
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		out = append(out, d)
+	}
+	return out, sc.Err()
+}
+
+type batchWriter interface {
+	write(res batchResult) error
+	flush() error
+}
+
+// jsonlBatchWriter writes each report as one compact JSON line.
+type jsonlBatchWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlBatchWriter) write(res batchResult) error {
+	return w.enc.Encode(res.report)
+}
+
+func (w *jsonlBatchWriter) flush() error { return nil }
+
+// csvBatchWriter flattens a report to one row per domain; multiple records
+// of one type are joined with ";".
+type csvBatchWriter struct {
+	w *csv.Writer
+}
+
+var csvBatchTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "SOA", "CAA"}
+
+func newCSVBatchWriter(out io.Writer) (*csvBatchWriter, error) {
+	w := &csvBatchWriter{w: csv.NewWriter(out)}
+	header := append([]string{"domain", "status", "errors"}, csvBatchTypes...)
+	header = append(header, "SPF", "DMARC", "DKIM", "MTA-STS", "TLS-RPT")
+	if err := w.w.Write(header); err != nil {
+		return nil, err
+	}
+	w.w.Flush()
+	return w, w.w.Error()
+}
+
+func (w *csvBatchWriter) write(res batchResult) error {
+	r := res.report
+	status := "ok"
+	if len(res.failures) > 0 {
+		status = "failed"
+	}
+	row := []string{r.Domain, status, strings.Join(res.failures, "; ")}
+
+	byType := map[string][]string{}
+	for _, q := range r.Queries {
+		for _, rec := range q.Records {
+			if rec.Type == q.Type {
+				byType[q.Type] = append(byType[q.Type], strings.TrimSpace(rec.Data))
+			}
+		}
+	}
+	for _, t := range csvBatchTypes {
+		row = append(row, strings.Join(byType[t], ";"))
+	}
+
+	if m := r.Mail; m != nil {
+		var dkim []string
+		for _, k := range m.DKIM {
+			dkim = append(dkim, k.Selector)
+		}
+		row = append(row, m.SPF, m.DMARC, strings.Join(dkim, ";"), m.MTASTS, m.TLSRPT)
+	} else {
+		row = append(row, "", "", "", "", "")
+	}
+
+	if err := w.w.Write(row); err != nil {
+		return err
+	}
+	// Flush per row so results stream while the batch is still running.
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvBatchWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
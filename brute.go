@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// defaultSubdomainWords is the built-in wordlist for -brute: common host
+// and service names. Use -w for a real list.
+var defaultSubdomainWords = []string{
+	"www", "mail", "webmail", "smtp", "imap", "pop", "pop3", "mx", "mx1", "mx2",
+	"ns", "ns1", "ns2", "ns3", "dns", "dns1", "dns2", "autodiscover", "autoconfig", "mta-sts",
+	"api", "app", "apps", "admin", "portal", "login", "auth", "sso", "id", "account",
+	"dev", "develop", "test", "testing", "staging", "stage", "acc", "acceptatie", "uat", "qa",
+	"prod", "beta", "demo", "sandbox", "preview", "old", "new", "legacy", "backup", "bak",
+	"vpn", "remote", "gateway", "gw", "proxy", "fw", "firewall", "router", "intranet", "extranet",
+	"git", "gitlab", "github", "jenkins", "ci", "build", "jira", "confluence", "wiki", "docs",
+	"status", "monitor", "monitoring", "grafana", "kibana", "prometheus", "logs", "metrics", "nagios", "zabbix",
+	"cdn", "static", "assets", "img", "images", "media", "files", "download", "downloads", "upload",
+	"shop", "store", "blog", "news", "forum", "support", "help", "helpdesk", "crm", "erp",
+	"db", "mysql", "sql", "postgres", "redis", "mongo", "elastic", "search", "ldap", "kerberos",
+	"ftp", "sftp", "ssh", "rdp", "citrix", "owa", "exchange", "lync", "sip", "teams",
+	"m", "mobile", "cloud", "s3", "storage", "vault", "k8s", "kube", "docker", "registry",
+	"office", "hr", "pay", "payments", "billing", "invoice", "partner", "partners", "client", "klant",
+}
+
+// bruteWords returns the wordlist for -brute: -w, or the built-in list.
+func bruteWords(o options) ([]string, error) {
+	if o.wordlist == "" {
+		return defaultSubdomainWords, nil
+	}
+	words, err := readWordlist(o.wordlist)
+	if err == nil && len(words) == 0 {
+		err = fmt.Errorf("%s: geen woorden", o.wordlist)
+	}
+	return words, err
+}
+
+// readWordlist reads one label per line; blank lines and # comments are
+// skipped, as are duplicates.
+func readWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seen := map[string]bool{}
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		w := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if w == "" || strings.HasPrefix(w, "#") || seen[w] {
+			continue
+		}
+		if _, ok := dns.IsDomainName(w); !ok || strings.ContainsAny(w, " \t") {
+			continue
+		}
+		seen[w] = true
+		words = append(words, strings.TrimSuffix(w, "."))
+	}
+	return words, sc.Err()
+}
+
+// bruteHost is a name that exists according to the resolver.
+type bruteHost struct {
+	Name  string   `json:"name"`
+	CNAME string   `json:"cname,omitempty"`
+	IPs   []string `json:"ips,omitempty"`
+}
+
+// bruteReport is the result of a wordlist enumeration.
+type bruteReport struct {
+	Words int         `json:"words"`
+	Found []bruteHost `json:"found"`
+
+	// Wildcards holds, per zone level that has a wildcard, the answers
+	// random labels got; names with only those answers are filtered out.
+	Wildcards map[string][]string `json:"wildcards,omitempty"`
+	Filtered  int                 `json:"wildcard_filtered,omitempty"`
+
+	Tried  int    `json:"tried"`
+	Errors int    `json:"errors,omitempty"`
+	Error  string `json:"error,omitempty"` // the first one
+	err    error
+}
+
+// bruteLookup resolves name to its A/AAAA addresses and the first CNAME.
+// exists is false for NXDOMAIN; a NOERROR without addresses (an empty
+// non-terminal, or a name with other types only) does exist.
+func bruteLookup(ctx context.Context, client *dns.Client, resolver, name string) (h bruteHost, exists bool, err error) {
+	h.Name = name
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		in, err := queryRecursive(ctx, client, resolver, name, qtype)
+		if err = answerError(in, err); err != nil {
+			return h, false, err
+		}
+		if in.Rcode == dns.RcodeNameError {
+			return h, false, nil
+		}
+		for _, rr := range in.Answer {
+			switch v := rr.(type) {
+			case *dns.CNAME:
+				if h.CNAME == "" {
+					h.CNAME = strings.ToLower(v.Target)
+				}
+			case *dns.A:
+				h.IPs = append(h.IPs, v.A.String())
+			case *dns.AAAA:
+				h.IPs = append(h.IPs, v.AAAA.String())
+			}
+		}
+	}
+	return h, true, nil
+}
+
+// wildcardAnswers probes random labels under zone. It returns the answers
+// (addresses and CNAME targets) a wildcard gives, or nil when there is none.
+func wildcardAnswers(ctx context.Context, client *dns.Client, resolver, zone string) []string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	set := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		label := make([]byte, 16)
+		for j := range label {
+			label[j] = letters[rand.IntN(len(letters))]
+		}
+		h, exists, err := bruteLookup(ctx, client, resolver, string(label)+"."+zone)
+		if err != nil || !exists {
+			continue
+		}
+		if h.CNAME != "" {
+			set[h.CNAME] = true
+		}
+		for _, ip := range h.IPs {
+			set[ip] = true
+		}
+		if h.CNAME == "" && len(h.IPs) == 0 {
+			set["(NOERROR)"] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return sortedKeys(set)
+}
+
+// isWildcardAnswer reports whether h only has answers the wildcard gives.
+// A load balanced wildcard can return addresses the probes did not see;
+// those names are kept.
+func isWildcardAnswer(h bruteHost, wildcard []string) bool {
+	if len(wildcard) == 0 {
+		return false
+	}
+	in := map[string]bool{}
+	for _, w := range wildcard {
+		in[w] = true
+	}
+	if h.CNAME != "" {
+		return in[h.CNAME]
+	}
+	if len(h.IPs) == 0 {
+		return in["(NOERROR)"]
+	}
+	for _, ip := range h.IPs {
+		if !in[ip] {
+			return false
+		}
+	}
+	return true
+}
+
+// bruteForce tries every word under domain on a pool of workers. Found
+// names are enumerated again up to depth levels deep (1 = only direct
+// subdomains). Each level is probed for a wildcard first.
+func bruteForce(ctx context.Context, client *dns.Client, resolver, domain string, words []string, workers, depth int) *bruteReport {
+	if workers < 1 {
+		workers = 1
+	}
+	rep := &bruteReport{Words: len(words), Wildcards: map[string][]string{}}
+	var mu sync.Mutex
+
+	parents := []string{dns.Fqdn(strings.ToLower(domain))}
+	for level := 1; level <= depth && len(parents) > 0; level++ {
+		type job struct {
+			name     string
+			wildcard []string
+		}
+		jobs := make(chan job)
+		var next []string
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range jobs {
+					h, exists, err := bruteLookup(ctx, client, resolver, j.name)
+					mu.Lock()
+					rep.Tried++
+					switch {
+					case err != nil:
+						rep.Errors++
+						if rep.err == nil {
+							rep.Error, rep.err = err.Error(), err
+						}
+					case !exists:
+					case isWildcardAnswer(h, j.wildcard):
+						rep.Filtered++
+					default:
+						rep.Found = append(rep.Found, h)
+						next = append(next, j.name)
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+
+		for _, parent := range parents {
+			wildcard := wildcardAnswers(ctx, client, resolver, parent)
+			if wildcard != nil {
+				rep.Wildcards[parent] = wildcard
+			}
+			for _, w := range words {
+				if ctx.Err() != nil {
+					break
+				}
+				jobs <- job{name: w + "." + parent, wildcard: wildcard}
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		parents = next
+	}
+
+	sort.Slice(rep.Found, func(i, j int) bool { return zoneNameLess(rep.Found[i].Name, rep.Found[j].Name) })
+	if len(rep.Wildcards) == 0 {
+		rep.Wildcards = nil
+	}
+	return rep
+}
+
+func printBrute(rep *bruteReport) {
+	fmt.Printf("%d woorden, %d namen geprobeerd, %d gevonden", rep.Words, rep.Tried, len(rep.Found))
+	if rep.Filtered > 0 {
+		fmt.Printf(", %d wildcard antwoorden weggefilterd", rep.Filtered)
+	}
+	fmt.Println()
+	for _, zone := range sortedKeys(rep.Wildcards) {
+		fmt.Printf("[!] wildcard DNS op *.%s -> %s\n", strings.TrimSuffix(zone, "."), strings.Join(rep.Wildcards[zone], ", "))
+	}
+	if rep.Errors > 0 {
+		fmt.Printf("error: %d queries mislukt (eerste: %s)\n", rep.Errors, rep.Error)
+	}
+	for _, h := range rep.Found {
+		name := strings.TrimSuffix(h.Name, ".")
+		switch {
+		case h.CNAME != "":
+			fmt.Printf("%s -> %s %s\n", name, strings.TrimSuffix(h.CNAME, "."), strings.Join(h.IPs, ", "))
+		case len(h.IPs) > 0:
+			fmt.Printf("%s %s\n", name, strings.Join(h.IPs, ", "))
+		default:
+			fmt.Printf("%s (bestaat, geen A/AAAA)\n", name)
+		}
+	}
+}
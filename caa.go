@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// caaProperty is a parsed CAA record (RFC 8659 section 4).
+type caaProperty struct {
+	Critical bool
+	Tag      string
+	Value    string
+
+	// Only set for issue/issuewild. An empty Issuer means "no CA may issue".
+	Issuer string
+	Params []caaParam
+}
+
+type caaParam struct {
+	Key   string
+	Value string
+}
+
+// caaRelevantSet is the outcome of the RFC 8659 tree climb.
+type caaRelevantSet struct {
+	Name       string   // name at which the CAA RRset was found ("" if none)
+	AliasChain []string // CNAMEs followed while looking up Name
+	Properties []caaProperty
+}
+
+// findRelevantCAA climbs from name towards the root (exclusive) and returns
+// the first non-empty CAA RRset. CNAMEs are followed by the resolver; the
+// CAA records are taken from the end of the alias chain.
+func findRelevantCAA(ctx context.Context, client *dns.Client, resolver, name string) (caaRelevantSet, error) {
+	labels := dns.SplitDomainName(name)
+	for i := range labels {
+		current := strings.Join(labels[i:], ".")
+		rrs, err := queryType(ctx, client, resolver, current, dns.TypeCAA)
+		if err != nil {
+			// A lookup failure must not be treated as "no CAA": stop climbing.
+			return caaRelevantSet{}, fmt.Errorf("CAA lookup %s: %w", current, err)
+		}
+
+		var set caaRelevantSet
+		for _, rr := range rrs {
+			switch v := rr.(type) {
+			case *dns.CNAME:
+				set.AliasChain = append(set.AliasChain, strings.TrimSuffix(v.Target, "."))
+			case *dns.CAA:
+				set.Properties = append(set.Properties, parseCAA(v))
+			}
+		}
+		if len(set.Properties) > 0 {
+			set.Name = current
+			return set, nil
+		}
+	}
+	return caaRelevantSet{}, nil
+}
+
+func parseCAA(rr *dns.CAA) caaProperty {
+	p := caaProperty{
+		Critical: rr.Flag&128 != 0,
+		Tag:      strings.ToLower(rr.Tag),
+		Value:    rr.Value,
+	}
+	if p.Tag != "issue" && p.Tag != "issuewild" {
+		return p
+	}
+
+	// issuer-domain-name *(";" key "=" value)
+	parts := strings.Split(rr.Value, ";")
+	p.Issuer = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(parts[0]), "."))
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(part, "=")
+		p.Params = append(p.Params, caaParam{Key: strings.TrimSpace(k), Value: strings.TrimSpace(v)})
+	}
+	return p
+}
+
+// caaKnownTags are the property tags we understand; an unknown tag with the
+// critical flag set forbids issuance altogether.
+var caaKnownTags = map[string]bool{
+	"issue":        true,
+	"issuewild":    true,
+	"iodef":        true,
+	"issuemail":    true,
+	"contactemail": true,
+	"contactphone": true,
+}
+
+// caaMayIssue evaluates the relevant set for a certificate authority
+// identified by its issuer domain (e.g. "letsencrypt.org"). The returned
+// properties are the ones that granted permission, so their parameters
+// (accounturi, validationmethods) can be shown as constraints.
+func caaMayIssue(set caaRelevantSet, ca string, wildcard bool) (bool, string, []caaProperty) {
+	ca = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(ca), "."))
+
+	if len(set.Properties) == 0 {
+		return true, "geen CAA records gevonden in de boom: elke CA mag uitgeven", nil
+	}
+
+	var issue, issuewild []caaProperty
+	for _, p := range set.Properties {
+		if p.Critical && !caaKnownTags[p.Tag] {
+			return false, fmt.Sprintf("onbekende critical tag %q: geen enkele CA mag uitgeven", p.Tag), nil
+		}
+		switch p.Tag {
+		case "issue":
+			issue = append(issue, p)
+		case "issuewild":
+			issuewild = append(issuewild, p)
+		}
+	}
+
+	tag, props := "issue", issue
+	if wildcard && len(issuewild) > 0 {
+		tag, props = "issuewild", issuewild
+	}
+	if len(props) == 0 {
+		return true, fmt.Sprintf("geen issue/issuewild properties bij %s: elke CA mag uitgeven", set.Name), nil
+	}
+
+	var matched []caaProperty
+	for _, p := range props {
+		if p.Issuer != "" && p.Issuer == ca {
+			matched = append(matched, p)
+		}
+	}
+	if len(matched) == 0 {
+		return false, fmt.Sprintf("%s staat niet in de %s properties van %s", ca, tag, set.Name), nil
+	}
+	return true, fmt.Sprintf("toegestaan via %s bij %s", tag, set.Name), matched
+}
+
+func runCAA(ctx context.Context, client *dns.Client, resolver, domain, ca string, wildcard bool) (bool, error) {
+	set, err := findRelevantCAA(ctx, client, resolver, domain)
+	if err != nil {
+		return false, err
+	}
+
+	if set.Name == "" {
+		fmt.Println("Relevante CAA set: (geen, tot aan de TLD)")
+	} else {
+		fmt.Printf("Relevante CAA set: %s\n", set.Name)
+		if len(set.AliasChain) > 0 {
+			fmt.Printf("  via CNAME: %s\n", strings.Join(set.AliasChain, " -> "))
+		}
+		for _, p := range set.Properties {
+			crit := ""
+			if p.Critical {
+				crit = " (critical)"
+			}
+			switch p.Tag {
+			case "issue", "issuewild":
+				issuer := p.Issuer
+				if issuer == "" {
+					issuer = "(geen CA toegestaan)"
+				}
+				fmt.Printf("  - %s%s: %s\n", p.Tag, crit, issuer)
+				for _, kv := range p.Params {
+					fmt.Printf("      %s=%s\n", kv.Key, kv.Value)
+				}
+			default:
+				fmt.Printf("  - %s%s: %s\n", p.Tag, crit, p.Value)
+			}
+		}
+	}
+
+	if ca == "" {
+		return true, nil
+	}
+
+	target := domain
+	if wildcard {
+		target = "*." + domain
+	}
+	ok, reason, matched := caaMayIssue(set, ca, wildcard)
+	verdict := "NEE"
+	if ok {
+		verdict = "JA"
+	}
+	fmt.Printf("\nMag %s uitgeven voor %s? %s (%s)\n", ca, target, verdict, reason)
+	for _, p := range matched {
+		for _, kv := range p.Params {
+			fmt.Printf("  voorwaarde: %s=%s\n", kv.Key, kv.Value)
+		}
+	}
+	return ok, nil
+}
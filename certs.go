@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ctCert is a certificate as a CT source lists it. crt.sh has one row per
+// log entry, so a precertificate and its certificate show up as one.
+type ctCert struct {
+	Serial    string    `json:"serial_number,omitempty"`
+	Issuer    string    `json:"issuer_name"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Names     []string  `json:"names"` // the names under the domain, "*." included
+}
+
+// parseCTCert reads the certificate fields of a source row: issuer_name,
+// not_before, not_after and serial_number (crt.sh), or issuer.name and the
+// validity of Cert Spotter. ok is false when the row has no issuer or
+// expiry.
+func parseCTCert(row map[string]any, names []string) (ctCert, bool) {
+	c := ctCert{Names: names}
+	c.Issuer, _ = row["issuer_name"].(string)
+	if iss, ok := row["issuer"].(map[string]any); ok && c.Issuer == "" {
+		c.Issuer, _ = iss["name"].(string)
+	}
+	c.Serial, _ = row["serial_number"].(string)
+	nb, _ := row["not_before"].(string)
+	na, _ := row["not_after"].(string)
+	c.NotBefore, c.NotAfter = parseCTTime(nb), parseCTTime(na)
+	if c.Issuer == "" || c.NotAfter.IsZero() || len(names) == 0 {
+		return ctCert{}, false
+	}
+	sort.Strings(c.Names)
+	return c, true
+}
+
+// parseCTTime parses the timestamps of crt.sh (UTC without a zone) and
+// Cert Spotter (RFC 3339).
+func parseCTTime(s string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// key identifies a certificate across sources. Not every source has the
+// serial, so it is left out.
+func (c ctCert) key() string {
+	return c.Issuer + "|" + c.NotBefore.Format(time.RFC3339) + "|" + c.NotAfter.Format(time.RFC3339) + "|" + strings.Join(c.Names, ",")
+}
+
+func (c ctCert) current(now time.Time) bool {
+	return !now.Before(c.NotBefore) && now.Before(c.NotAfter)
+}
+
+// dedupeCerts merges certificates with the same key, keeping a serial
+// when one of them has it, newest first.
+func dedupeCerts(certs []ctCert) []ctCert {
+	idx := map[string]int{}
+	var out []ctCert
+	for _, c := range certs {
+		if i, ok := idx[c.key()]; ok {
+			if out[i].Serial == "" {
+				out[i].Serial = c.Serial
+			}
+			continue
+		}
+		idx[c.key()] = len(out)
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].NotAfter.After(out[j].NotAfter) })
+	return out
+}
+
+// dnField returns the value of key (O, CN, ...) in a distinguished name
+// like "C=US, O=Let's Encrypt, CN=R3".
+func dnField(dn, key string) string {
+	for _, part := range strings.Split(dn, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && strings.EqualFold(k, key) {
+			return strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return ""
+}
+
+// issuerLabel shortens an issuer name to organisation and CN, or just the
+// CN when it already names the organisation.
+func issuerLabel(dn string) string {
+	o, cn := dnField(dn, "O"), dnField(dn, "CN")
+	switch {
+	case o != "" && cn != "":
+		if word := strings.Fields(o); len(word) > 0 && strings.Contains(cn, word[0]) {
+			return cn
+		}
+		return o + " " + cn
+	case cn != "":
+		return cn
+	case o != "":
+		return o
+	}
+	return dn
+}
+
+// caIssuerDomains maps the organisation in an issuer name to the CAA
+// issuer domains (RFC 8659) that CA accepts.
+var caIssuerDomains = []struct {
+	org     string
+	domains []string
+}{
+	{"let's encrypt", []string{"letsencrypt.org"}},
+	{"google trust services", []string{"pki.goog"}},
+	{"amazon", []string{"amazon.com", "amazontrust.com", "awstrust.com", "amazonaws.com"}},
+	{"digicert", []string{"digicert.com", "symantec.com", "geotrust.com", "thawte.com", "rapidssl.com"}},
+	{"cloudflare", []string{"digicert.com", "cloudflare.com"}},
+	{"microsoft", []string{"microsoft.com", "digicert.com"}},
+	{"quovadis", []string{"quovadisglobal.com", "digicert.com"}},
+	{"zerossl", []string{"sectigo.com", "zerossl.com"}},
+	{"sectigo", []string{"sectigo.com", "comodoca.com", "comodo.com", "usertrust.com", "trust-provider.com"}},
+	{"comodo", []string{"sectigo.com", "comodoca.com", "comodo.com"}},
+	{"globalsign", []string{"globalsign.com"}},
+	{"entrust", []string{"entrust.net"}},
+	{"buypass", []string{"buypass.com", "buypass.no"}},
+	{"ssl.com", []string{"ssl.com"}},
+	{"godaddy", []string{"godaddy.com", "starfieldtech.com"}},
+	{"starfield", []string{"godaddy.com", "starfieldtech.com"}},
+	{"harica", []string{"harica.gr"}},
+	{"certum", []string{"certum.pl", "certum.eu"}},
+	{"asseco", []string{"certum.pl", "certum.eu"}},
+	{"actalis", []string{"actalis.it"}},
+}
+
+// caaDomainsFor returns the CAA issuer domains of the CA behind an issuer
+// name, or nil when the CA is not known.
+func caaDomainsFor(issuer string) []string {
+	o := strings.ToLower(dnField(issuer, "O"))
+	if o == "" {
+		o = strings.ToLower(issuer)
+	}
+	for _, ca := range caIssuerDomains {
+		if strings.Contains(o, ca.org) {
+			return ca.domains
+		}
+	}
+	return nil
+}
+
+// issuerUsage is the number of certificates of one issuer.
+type issuerUsage struct {
+	Issuer       string `json:"issuer"`
+	Certificates int    `json:"certificates"`
+	Current      int    `json:"current"`
+}
+
+// nameCerts summarises the certificates of one name.
+type nameCerts struct {
+	Name         string    `json:"name"`
+	Certificates int       `json:"certificates"`
+	Current      int       `json:"current"`
+	NotAfter     time.Time `json:"not_after"` // of the newest certificate
+	Issuer       string    `json:"issuer"`    // of the newest certificate
+}
+
+// certExpiry is a name whose newest certificate expires within the
+// warning window.
+type certExpiry struct {
+	Name     string    `json:"name"`
+	NotAfter time.Time `json:"not_after"`
+	Days     int       `json:"days"`
+	Issuer   string    `json:"issuer"`
+}
+
+// caaMismatch is a current certificate from a CA the CAA records of the
+// name do not allow.
+type caaMismatch struct {
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+	Serial string `json:"serial_number,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// certReport is the analysis of the certificates found in CT.
+type certReport struct {
+	Total          int               `json:"total"`
+	Current        int               `json:"current"`
+	WarnDays       int               `json:"warn_days"`
+	Issuers        []issuerUsage     `json:"issuers"`
+	Names          []nameCerts       `json:"names"`
+	Expiring       []certExpiry      `json:"expiring,omitempty"`
+	UnexpectedCA   []caaMismatch     `json:"unexpected_ca,omitempty"`
+	UnknownIssuers []string          `json:"unknown_issuers,omitempty"` // current issuers that cannot be checked against CAA
+	CAAErrors      map[string]string `json:"caa_errors,omitempty"`      // failed CAA lookups, per name
+	List           []ctCert          `json:"list"`
+
+	caaErrs map[string]error
+}
+
+// analyseCerts reports the certificates per name and issuer, the names
+// whose newest certificate expires within warnDays, and current
+// certificates from a CA the CAA records (RFC 8659 tree climb per name)
+// do not allow. CAA is checked as it is now, so a certificate issued
+// before a CAA change shows up as well.
+func analyseCerts(ctx context.Context, client *dns.Client, resolver string, certs []ctCert, warnDays int, now time.Time) *certReport {
+	rep := &certReport{Total: len(certs), WarnDays: warnDays, List: certs}
+	if rep.List == nil {
+		rep.List = []ctCert{}
+	}
+
+	issuers := map[string]*issuerUsage{}
+	names := map[string]*nameCerts{}
+	for _, c := range certs {
+		cur := c.current(now)
+		u := issuers[c.Issuer]
+		if u == nil {
+			u = &issuerUsage{Issuer: c.Issuer}
+			issuers[c.Issuer] = u
+		}
+		u.Certificates++
+		if cur {
+			rep.Current++
+			u.Current++
+		}
+		for _, name := range c.Names {
+			n := names[name]
+			if n == nil {
+				n = &nameCerts{Name: name}
+				names[name] = n
+			}
+			n.Certificates++
+			if cur {
+				n.Current++
+			}
+			if c.NotAfter.After(n.NotAfter) {
+				n.NotAfter, n.Issuer = c.NotAfter, c.Issuer
+			}
+		}
+	}
+	for _, u := range issuers {
+		rep.Issuers = append(rep.Issuers, *u)
+	}
+	sort.Slice(rep.Issuers, func(i, j int) bool {
+		if rep.Issuers[i].Certificates != rep.Issuers[j].Certificates {
+			return rep.Issuers[i].Certificates > rep.Issuers[j].Certificates
+		}
+		return rep.Issuers[i].Issuer < rep.Issuers[j].Issuer
+	})
+	for _, name := range sortedKeys(names) {
+		n := *names[name]
+		rep.Names = append(rep.Names, n)
+		if left := n.NotAfter.Sub(now); left > 0 && left < time.Duration(warnDays)*24*time.Hour {
+			rep.Expiring = append(rep.Expiring, certExpiry{Name: n.Name, NotAfter: n.NotAfter, Days: int(left.Hours() / 24), Issuer: n.Issuer})
+		}
+	}
+
+	rep.checkCAA(ctx, client, resolver, certs, now)
+	return rep
+}
+
+// checkCAA fills UnexpectedCA and UnknownIssuers. The relevant CAA set is
+// looked up once per name; a name whose lookup fails is recorded in
+// CAAErrors and skipped.
+func (rep *certReport) checkCAA(ctx context.Context, client *dns.Client, resolver string, certs []ctCert, now time.Time) {
+	sets := map[string]caaRelevantSet{}
+	seen := map[string]bool{}
+	unknown := map[string]bool{}
+	for _, c := range certs {
+		if !c.current(now) {
+			continue
+		}
+		domains := caaDomainsFor(c.Issuer)
+		for _, name := range c.Names {
+			bare := strings.TrimPrefix(name, "*.")
+			if _, failed := rep.CAAErrors[bare]; failed {
+				continue
+			}
+			set, ok := sets[bare]
+			if !ok {
+				var err error
+				if set, err = findRelevantCAA(ctx, client, resolver, bare); err != nil {
+					if rep.CAAErrors == nil {
+						rep.CAAErrors, rep.caaErrs = map[string]string{}, map[string]error{}
+					}
+					rep.CAAErrors[bare], rep.caaErrs[bare] = err.Error(), err
+					continue
+				}
+				sets[bare] = set
+			}
+			if len(set.Properties) == 0 {
+				continue
+			}
+			if domains == nil {
+				unknown[c.Issuer] = true
+				continue
+			}
+			// The reason shown is that of the main domain of the CA.
+			allowed, reason := false, ""
+			for i, d := range domains {
+				ok, why, _ := caaMayIssue(set, d, name != bare)
+				if i == 0 {
+					reason = why
+				}
+				if ok {
+					allowed = true
+					break
+				}
+			}
+			if !allowed && !seen[name+"|"+c.Issuer] {
+				seen[name+"|"+c.Issuer] = true
+				rep.UnexpectedCA = append(rep.UnexpectedCA, caaMismatch{Name: name, Issuer: c.Issuer, Serial: c.Serial, Reason: reason})
+			}
+		}
+	}
+	rep.UnknownIssuers = sortedKeys(unknown)
+	sort.SliceStable(rep.UnexpectedCA, func(i, j int) bool { return rep.UnexpectedCA[i].Name < rep.UnexpectedCA[j].Name })
+}
+
+func printCerts(rep *certReport) {
+	fmt.Printf("%d certificaten, %d nu geldig\n", rep.Total, rep.Current)
+	if rep.Total == 0 {
+		fmt.Println("Geen certificaatgegevens in de CT resultaten")
+		return
+	}
+
+	fmt.Println("\nUitgevers:")
+	for _, u := range rep.Issuers {
+		fmt.Printf("  %s: %d (%d geldig)\n", issuerLabel(u.Issuer), u.Certificates, u.Current)
+	}
+
+	fmt.Println("\nPer naam:")
+	for _, n := range rep.Names {
+		fmt.Printf("  %s: %d certificaten, %d geldig, nieuwste tot %s (%s)\n",
+			n.Name, n.Certificates, n.Current, n.NotAfter.Format("2006-01-02"), issuerLabel(n.Issuer))
+	}
+
+	if len(rep.Expiring) > 0 || len(rep.UnexpectedCA) > 0 || len(rep.UnknownIssuers) > 0 || len(rep.CAAErrors) > 0 {
+		fmt.Println()
+	}
+	for _, e := range rep.Expiring {
+		fmt.Printf("[!] %s: nieuwste certificaat verloopt over %d dagen (%s, %s)\n",
+			e.Name, e.Days, e.NotAfter.Format("2006-01-02"), issuerLabel(e.Issuer))
+	}
+	for _, m := range rep.UnexpectedCA {
+		serial := ""
+		if m.Serial != "" {
+			serial = ", serial " + m.Serial
+		}
+		fmt.Printf("[!] %s: geldig certificaat van %s%s, maar CAA staat het niet toe: %s\n", m.Name, issuerLabel(m.Issuer), serial, m.Reason)
+	}
+	for _, iss := range rep.UnknownIssuers {
+		fmt.Printf("CAA check niet mogelijk voor onbekende CA: %s\n", iss)
+	}
+	for _, name := range sortedKeys(rep.CAAErrors) {
+		fmt.Printf("error: CAA %s: %s\n", name, rep.CAAErrors[name])
+	}
+}
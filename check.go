@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// checkSpec is the assertion file for "ultradns check":
+//
+//	domain: example.com
+//	checks:
+//	  - type: MX
+//	    equals: ["10 mx1.example.com.", "20 mx2.example.com."]
+//	  - name: www
+//	    type: A
+//	    contains: ["192.0.2.10"]
+//	    max_ttl: 3600
+//	  - dmarc: {p: reject}
+type checkSpec struct {
+	Domain   string           `yaml:"domain"`
+	Resolver string           `yaml:"resolver"`
+	Checks   []checkAssertion `yaml:"checks"`
+}
+
+// checkAssertion is one expectation. Name is relative to the domain ("@"
+// or empty is the apex, a name ending in a dot is absolute). Record data is
+// written as in a zone file; TXT data is compared as the joined string.
+type checkAssertion struct {
+	Title  string `yaml:"title"`
+	Domain string `yaml:"domain"`
+	Name   string `yaml:"name"`
+	Type   string `yaml:"type"`
+
+	Equals   []string `yaml:"equals"`
+	Contains []string `yaml:"contains"`
+	Excludes []string `yaml:"excludes"`
+	Matches  string   `yaml:"matches"`
+	Exists   *bool    `yaml:"exists"`
+	MinTTL   *uint32  `yaml:"min_ttl"`
+	MaxTTL   *uint32  `yaml:"max_ttl"`
+
+	// DMARC and SPF check tags of the policy records: dmarc: {p: reject},
+	// spf: {all: -all}.
+	DMARC map[string]string `yaml:"dmarc"`
+	SPF   map[string]string `yaml:"spf"`
+}
+
+// checkResult is the outcome of one assertion. Error means it could not be
+// evaluated (query failure), which is reported apart from a failure.
+type checkResult struct {
+	Title    string        `json:"title"`
+	Passed   bool          `json:"passed"`
+	Failures []string      `json:"failures,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+func readCheckSpec(path string) (*checkSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var spec checkSpec
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(spec.Checks) == 0 {
+		return nil, fmt.Errorf("%s: geen checks", path)
+	}
+	return &spec, nil
+}
+
+// prepare fills in defaults and validates a, so spec errors show up before
+// any query is sent.
+func (a *checkAssertion) prepare(domain string) error {
+	if a.Domain == "" {
+		a.Domain = domain
+	}
+	if a.Domain == "" {
+		return fmt.Errorf("geen domein (zet domain: in de spec of gebruik -d)")
+	}
+	a.Domain = normalizeDomain(a.Domain)
+	switch {
+	case a.DMARC != nil:
+		a.Type = "TXT"
+		if a.Name == "" || a.Name == "@" {
+			a.Name = "_dmarc"
+		}
+	case a.SPF != nil:
+		a.Type = "TXT"
+	}
+	if a.Type == "" {
+		return fmt.Errorf("type ontbreekt")
+	}
+	a.Type = strings.ToUpper(a.Type)
+	if _, ok := dns.StringToType[a.Type]; !ok {
+		return fmt.Errorf("onbekend type %q", a.Type)
+	}
+	if a.Matches != "" {
+		if _, err := regexp.Compile(a.Matches); err != nil {
+			return fmt.Errorf("matches: %w", err)
+		}
+	}
+	if a.Title == "" {
+		a.Title = a.describe()
+	}
+	return nil
+}
+
+func (a *checkAssertion) owner() string {
+	switch {
+	case a.Name == "" || a.Name == "@":
+		return dns.Fqdn(a.Domain)
+	case dns.IsFqdn(a.Name):
+		return a.Name
+	}
+	return a.Name + "." + dns.Fqdn(a.Domain)
+}
+
+func (a *checkAssertion) describe() string {
+	var parts []string
+	switch {
+	case a.Equals != nil:
+		parts = append(parts, "= "+strings.Join(a.Equals, ", "))
+	case a.Contains != nil:
+		parts = append(parts, "bevat "+strings.Join(a.Contains, ", "))
+	}
+	if a.Excludes != nil {
+		parts = append(parts, "zonder "+strings.Join(a.Excludes, ", "))
+	}
+	if a.Matches != "" {
+		parts = append(parts, "~ /"+a.Matches+"/")
+	}
+	if a.Exists != nil {
+		parts = append(parts, fmt.Sprintf("bestaat=%t", *a.Exists))
+	}
+	for _, tags := range []map[string]string{a.DMARC, a.SPF} {
+		for _, k := range sortedKeys(tags) {
+			parts = append(parts, k+"="+tags[k])
+		}
+	}
+	if a.MinTTL != nil {
+		parts = append(parts, fmt.Sprintf("TTL >= %d", *a.MinTTL))
+	}
+	if a.MaxTTL != nil {
+		parts = append(parts, fmt.Sprintf("TTL <= %d", *a.MaxTTL))
+	}
+	return strings.TrimSpace(a.owner() + " " + a.Type + " " + strings.Join(parts, "; "))
+}
+
+// normalizeRData brings record data into the form rrData produces, so
+// "10 MX1.example.com" and "10 mx1.example.com." compare equal. TXT data
+// is the joined string, as in actualRData: quoted data is parsed like a
+// zone file ("a" "b", escapes), unquoted data is taken as is.
+func normalizeRData(qtype uint16, owner, data string) string {
+	if qtype == dns.TypeTXT {
+		if !strings.HasPrefix(strings.TrimSpace(data), `"`) {
+			return data
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN TXT %s", owner, data))
+		if err != nil || rr == nil {
+			return strings.Trim(data, `"`)
+		}
+		return actualRData(rr)
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", owner, dns.TypeToString[qtype], data))
+	if err != nil || rr == nil {
+		return strings.ToLower(data)
+	}
+	return strings.ToLower(rrData(rr))
+}
+
+func actualRData(rr dns.RR) string {
+	if t, ok := rr.(*dns.TXT); ok {
+		return strings.Join(t.Txt, "")
+	}
+	return strings.ToLower(rrData(rr))
+}
+
+// evaluate queries the resolver and checks every expectation in a.
+func (a *checkAssertion) evaluate(ctx context.Context, client *dns.Client, resolver string) (res checkResult) {
+	start := time.Now()
+	res.Title = a.Title
+	defer func() { res.Duration = time.Since(start) }()
+
+	qtype := dns.StringToType[a.Type]
+	owner := a.owner()
+	in, err := queryRecursive(ctx, client, resolver, owner, qtype)
+	if err = answerError(in, err); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	// The answer may start with a CNAME chain; the records of the asked
+	// type at its end are what clients get.
+	var rrs []dns.RR
+	for _, rr := range in.Answer {
+		if rr.Header().Rrtype == qtype {
+			rrs = append(rrs, rr)
+		}
+	}
+	have := map[string]bool{}
+	var values []string
+	for _, rr := range rrs {
+		v := actualRData(rr)
+		have[v] = true
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	got := "[" + strings.Join(values, " | ") + "]"
+	fail := func(format string, args ...any) {
+		res.Failures = append(res.Failures, fmt.Sprintf(format, args...))
+	}
+
+	if a.Exists != nil && *a.Exists != (len(rrs) > 0) {
+		if *a.Exists {
+			fail("geen %s records", a.Type)
+		} else {
+			fail("verwacht geen records, kreeg %s", got)
+		}
+	}
+	if a.Equals != nil {
+		want := map[string]bool{}
+		for _, e := range a.Equals {
+			want[normalizeRData(qtype, owner, e)] = true
+		}
+		same := len(want) == len(have)
+		for v := range want {
+			same = same && have[v]
+		}
+		if !same {
+			fail("verwacht [%s], kreeg %s", strings.Join(sortedKeys(want), " | "), got)
+		}
+	}
+	for _, e := range a.Contains {
+		if !have[normalizeRData(qtype, owner, e)] {
+			fail("%q ontbreekt in %s", e, got)
+		}
+	}
+	for _, e := range a.Excludes {
+		if have[normalizeRData(qtype, owner, e)] {
+			fail("%q hoort er niet in te staan", e)
+		}
+	}
+	if a.Matches != "" {
+		re := regexp.MustCompile(a.Matches)
+		matched := false
+		for _, v := range values {
+			matched = matched || re.MatchString(v)
+		}
+		if !matched {
+			fail("geen record matcht /%s/: %s", a.Matches, got)
+		}
+	}
+	for _, rr := range rrs {
+		ttl := rr.Header().Ttl
+		if a.MinTTL != nil && ttl < *a.MinTTL {
+			fail("TTL %d is lager dan %d", ttl, *a.MinTTL)
+			break
+		}
+		if a.MaxTTL != nil && ttl > *a.MaxTTL {
+			fail("TTL %d is hoger dan %d", ttl, *a.MaxTTL)
+			break
+		}
+	}
+	if a.DMARC != nil {
+		checkPolicyTags(fail, "DMARC", values, "v=dmarc1", a.DMARC, func(v string) map[string]string {
+			_, tags := dmarcTags(v)
+			return tags
+		})
+	}
+	if a.SPF != nil {
+		checkPolicyTags(fail, "SPF", values, "v=spf1", a.SPF, spfTags)
+	}
+
+	res.Passed = len(res.Failures) == 0
+	return res
+}
+
+// checkPolicyTags finds the one policy record starting with prefix and
+// compares its tags with want. An empty wanted value means the tag must be
+// absent.
+func checkPolicyTags(fail func(string, ...any), kind string, values []string, prefix string, want map[string]string, parse func(string) map[string]string) {
+	var records []string
+	for _, v := range values {
+		if strings.HasPrefix(strings.ToLower(v), prefix) {
+			records = append(records, v)
+		}
+	}
+	if len(records) != 1 {
+		fail("%d %s records gevonden, verwacht 1", len(records), kind)
+		return
+	}
+	tags := parse(records[0])
+	for _, k := range sortedKeys(want) {
+		got, ok := tags[strings.ToLower(k)]
+		switch {
+		case want[k] == "" && ok:
+			fail("%s %s=%s hoort er niet te zijn", kind, k, got)
+		case want[k] != "" && !strings.EqualFold(got, want[k]):
+			fail("%s %s is %q, verwacht %q", kind, k, got, want[k])
+		}
+	}
+}
+
+// spfTags indexes an SPF record for assertions: "all" holds the all term
+// with its qualifier, "redirect" and "exp" their argument, and every other
+// mechanism is present with its arguments joined ("include": "a.com b.com").
+func spfTags(v string) map[string]string {
+	tags := map[string]string{}
+	for _, term := range strings.Fields(v)[1:] {
+		if k, arg, ok := strings.Cut(term, "="); ok {
+			tags[strings.ToLower(k)] = arg
+			continue
+		}
+		mech := strings.ToLower(strings.TrimLeft(term, "+-~?"))
+		name, arg, _ := strings.Cut(mech, ":")
+		if name == "all" {
+			tags["all"] = term
+			continue
+		}
+		tags[name] = strings.TrimSpace(tags[name] + " " + arg)
+	}
+	return tags
+}
+
+// JUnit XML, in the subset CI systems (GitLab, Jenkins, GitHub actions)
+// read.
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Stamp    string      `xml:"timestamp,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func writeJUnit(path, suite string, checks []checkAssertion, results []checkResult, start time.Time) error {
+	s := junitSuite{Name: suite, Tests: len(results), Stamp: start.UTC().Format(time.RFC3339)}
+	var total time.Duration
+	for i, r := range results {
+		c := junitCase{Name: r.Title, Classname: checks[i].Domain, Time: fmt.Sprintf("%.3f", r.Duration.Seconds())}
+		total += r.Duration
+		switch {
+		case r.Error != "":
+			s.Errors++
+			c.Error = &junitMessage{Message: r.Error, Body: r.Error}
+		case !r.Passed:
+			s.Failures++
+			c.Failure = &junitMessage{Message: r.Failures[0], Body: strings.Join(r.Failures, "\n")}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	s.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	b, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(b, '\n')...), 0o644)
+}
+
+// runCheckCmd implements "ultradns check". Exit codes: 0 all assertions
+// pass, 1 a failure or query error, 2 the spec is invalid.
+func runCheckCmd(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var specPath, domain, junitPath, resolverFlag string
+	var asJSON bool
+	var timeout time.Duration
+	fs.StringVar(&specPath, "spec", "", "YAML bestand met de assertions")
+	fs.StringVar(&domain, "d", "", "Domein (overschrijft domain: uit de spec)")
+	fs.StringVar(&junitPath, "junit", "", "Schrijf de resultaten als JUnit XML naar dit bestand")
+	fs.StringVar(&resolverFlag, "r", "", "Resolver (ip:port). Default: resolver: uit de spec, systeem resolvers of 8.8.8.8:53")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Timeout per query")
+	fs.BoolVar(&asJSON, "json", false, "Output als JSON")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns check -spec dns.yaml [-d example.com] [-junit resultaten.xml]\n\n")
+		fmt.Fprintf(os.Stderr, "Toetst de live DNS aan de verwachtingen in een YAML bestand, bijvoorbeeld:\n\n")
+		fmt.Fprintf(os.Stderr, "  domain: example.com\n")
+		fmt.Fprintf(os.Stderr, "  checks:\n")
+		fmt.Fprintf(os.Stderr, "    - type: MX\n")
+		fmt.Fprintf(os.Stderr, "      equals: [\"10 mx1.example.com.\", \"20 mx2.example.com.\"]\n")
+		fmt.Fprintf(os.Stderr, "    - name: www\n")
+		fmt.Fprintf(os.Stderr, "      type: A\n")
+		fmt.Fprintf(os.Stderr, "      contains: [192.0.2.10]\n")
+		fmt.Fprintf(os.Stderr, "      max_ttl: 3600\n")
+		fmt.Fprintf(os.Stderr, "    - dmarc: {p: reject}\n")
+		fmt.Fprintf(os.Stderr, "    - spf: {all: -all}\n\n")
+		fmt.Fprintf(os.Stderr, "Per check: title, domain, name, type, equals, contains, excludes, matches (regex), exists,\n")
+		fmt.Fprintf(os.Stderr, "min_ttl, max_ttl, dmarc (tags) en spf (all, include, redirect, ...).\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = alles geslaagd, 1 = een check faalt, 2 = fout in de spec.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if specPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	spec, err := readCheckSpec(specPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	if domain == "" {
+		domain = spec.Domain
+	}
+	for i := range spec.Checks {
+		if err := spec.Checks[i].prepare(domain); err != nil {
+			fmt.Fprintf(os.Stderr, "error: check %d: %v\n", i+1, err)
+			return exitUsage
+		}
+	}
+	if resolverFlag == "" {
+		resolverFlag = spec.Resolver
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	client := &dns.Client{Timeout: timeout}
+	resolver := pickResolver(resolverFlag)
+
+	start := time.Now()
+	var results []checkResult
+	failed := 0
+	for i := range spec.Checks {
+		r := spec.Checks[i].evaluate(ctx, client, resolver)
+		if !r.Passed {
+			failed++
+		}
+		results = append(results, r)
+	}
+
+	if junitPath != "" {
+		suite := "ultradns check " + specPath
+		if err := writeJUnit(junitPath, suite, spec.Checks, results, start); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, results); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	} else {
+		printBanner()
+		printHeader("CHECK " + specPath)
+		fmt.Printf("resolver: %s\n\n", resolver)
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				fmt.Printf("ERROR %s\n      %s\n", r.Title, r.Error)
+			case r.Passed:
+				fmt.Printf("PASS  %s\n", r.Title)
+			default:
+				fmt.Printf("FAIL  %s\n", r.Title)
+				for _, f := range r.Failures {
+					fmt.Printf("      %s\n", f)
+				}
+			}
+		}
+		fmt.Printf("\n%d/%d geslaagd\n", len(results)-failed, len(results))
+	}
+
+	if failed > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// delegation is what a parent zone server says about a child zone.
+type delegation struct {
+	Parent string              `json:"parent"`
+	Server string              `json:"server"`
+	NS     []string            `json:"ns"`
+	NSTTL  uint32              `json:"ns_ttl"`
+	Glue   map[string][]string `json:"glue,omitempty"` // ns host -> addresses
+}
+
+// queryAuth sends a non-recursive query straight to an authoritative server
+// and returns the whole message, so referrals (authority + additional) can be
+// inspected.
+func queryAuth(ctx context.Context, client *dns.Client, server, name string, qtype uint16) (*dns.Msg, error) {
+	if err := waitQuerySlot(ctx); err != nil {
+		return nil, err
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = false
+
+	rctx, cancel := context.WithTimeout(ctx, client.Timeout)
+	defer cancel()
+
+	in, _, err := client.ExchangeContext(rctx, m, server)
+	if err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// findZoneCut returns the closest enclosing zone of name (name itself
+// excluded) together with its nameservers, as seen by the resolver.
+func findZoneCut(ctx context.Context, client *dns.Client, resolver, name string) (string, []string, error) {
+	labels := dns.SplitDomainName(name)
+	for i := 1; i < len(labels); i++ {
+		zone := strings.Join(labels[i:], ".")
+		rrs, err := queryType(ctx, client, resolver, zone, dns.TypeNS)
+		if err != nil {
+			return "", nil, err
+		}
+		var ns []string
+		for _, rr := range rrs {
+			if v, ok := rr.(*dns.NS); ok && strings.EqualFold(v.Hdr.Name, dns.Fqdn(zone)) {
+				ns = append(ns, strings.ToLower(strings.TrimSuffix(v.Ns, ".")))
+			}
+		}
+		if len(ns) > 0 {
+			return zone, ns, nil
+		}
+	}
+	// Fall back to the root zone for TLDs (and single-label names).
+	rrs, err := queryType(ctx, client, resolver, ".", dns.TypeNS)
+	if err != nil {
+		return "", nil, err
+	}
+	var ns []string
+	for _, rr := range rrs {
+		if v, ok := rr.(*dns.NS); ok {
+			ns = append(ns, strings.ToLower(strings.TrimSuffix(v.Ns, ".")))
+		}
+	}
+	if len(ns) == 0 {
+		return "", nil, errors.New("geen parent zone gevonden")
+	}
+	return ".", ns, nil
+}
+
+// hasIPv6Route reports whether this host can reach IPv6 addresses at all.
+// Connecting a UDP socket sends nothing; it only needs a route.
+var hasIPv6Route = sync.OnceValue(func() bool {
+	c, err := net.Dial("udp6", "[2001:4860:4860::8888]:53")
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+})
+
+// reachableAddrs drops the IPv6 addresses when there is no IPv6 route, and
+// returns them separately.
+func reachableAddrs(addrs []string) (ok, skipped []string) {
+	if hasIPv6Route() {
+		return addrs, nil
+	}
+	for _, a := range addrs {
+		if ip := net.ParseIP(a); ip != nil && ip.To4() == nil {
+			skipped = append(skipped, a)
+		} else {
+			ok = append(ok, a)
+		}
+	}
+	return ok, skipped
+}
+
+// transportError reports whether err means a server could not be reached
+// (timeout, refused, no route) rather than that it answered badly.
+func transportError(err error) bool {
+	code := classifyError(err)
+	return code == exitTimeout || code == exitUnreachable
+}
+
+// resolveHost returns the IPv4 and IPv6 addresses of host via the resolver.
+func resolveHost(ctx context.Context, client *dns.Client, resolver, host string) (v4, v6 []string) {
+	a, _ := queryType(ctx, client, resolver, host, dns.TypeA)
+	aaaa, _ := queryType(ctx, client, resolver, host, dns.TypeAAAA)
+	return extractIPs(a), extractIPs(aaaa)
+}
+
+// parentDelegation asks the parent zone servers (without recursion) for the
+// delegation of domain: the NS set and glue as published by the registry.
+func parentDelegation(ctx context.Context, client *dns.Client, resolver, domain string) (delegation, error) {
+	parent, parentNS, err := findZoneCut(ctx, client, resolver, domain)
+	if err != nil {
+		return delegation{}, err
+	}
+
+	var lastErr error
+	for _, host := range parentNS {
+		v4, v6 := resolveHost(ctx, client, resolver, host)
+		for _, ip := range append(v4, v6...) {
+			in, err := queryAuth(ctx, client, net.JoinHostPort(ip, "53"), domain, dns.TypeNS)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if in.Rcode != dns.RcodeSuccess {
+				lastErr = fmt.Errorf("%s: rcode %s", host, dns.RcodeToString[in.Rcode])
+				continue
+			}
+			d := delegation{Parent: parent, Server: host, Glue: map[string][]string{}}
+			// A referral carries the NS set in the authority section; a parent
+			// that is also authoritative for the child answers directly.
+			for _, rr := range append(in.Ns, in.Answer...) {
+				if v, ok := rr.(*dns.NS); ok && strings.EqualFold(v.Hdr.Name, dns.Fqdn(domain)) {
+					d.NS = append(d.NS, strings.ToLower(strings.TrimSuffix(v.Ns, ".")))
+					d.NSTTL = v.Hdr.Ttl
+				}
+			}
+			for _, rr := range in.Extra {
+				owner := strings.ToLower(strings.TrimSuffix(rr.Header().Name, "."))
+				for _, ip := range extractIPs([]dns.RR{rr}) {
+					d.Glue[owner] = append(d.Glue[owner], ip)
+				}
+			}
+			if len(d.NS) == 0 {
+				lastErr = fmt.Errorf("%s gaf geen delegatie voor %s", host, domain)
+				continue
+			}
+			return d, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("geen parent nameserver bereikbaar")
+	}
+	return delegation{}, lastErr
+}
+
+// inBailiwick reports whether host is inside zone and thus needs glue.
+func inBailiwick(host, zone string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	return host == zone || strings.HasSuffix(host, "."+zone)
+}
+
+// nsServerCheck is what one nameserver address said about the child zone.
+type nsServerCheck struct {
+	Host          string   `json:"host"`
+	IP            string   `json:"ip"`
+	Authoritative bool     `json:"authoritative"`
+	NS            []string `json:"ns,omitempty"`
+	Serial        uint32   `json:"serial,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	Unreachable   bool     `json:"unreachable,omitempty"` // Error is a timeout or network error
+}
+
+type delegationReport struct {
+	Parent   delegation      `json:"parent"`
+	ChildNS  []string        `json:"child_ns,omitempty"`
+	Servers  []nsServerCheck `json:"servers,omitempty"`
+	Findings []string        `json:"findings,omitempty"`
+
+	// Unreachable lists addresses that could not be asked from here (no
+	// IPv6 route, timeout, network error). They are not findings: the
+	// server may be fine for everyone else.
+	Unreachable []string `json:"unreachable,omitempty"`
+}
+
+// checkDelegation compares the delegation at the parent with what the
+// child's own nameservers serve, similar to the zonemaster delegation and
+// consistency tests: lame servers, NS set mismatches, missing or stale glue,
+// NS names that are CNAMEs and differing SOA serials.
+func checkDelegation(ctx context.Context, client *dns.Client, resolver, domain string) (*delegationReport, error) {
+	parent, err := parentDelegation(ctx, client, resolver, domain)
+	if err != nil {
+		return nil, err
+	}
+	rep := &delegationReport{Parent: parent}
+	finding := func(format string, args ...any) {
+		rep.Findings = append(rep.Findings, fmt.Sprintf(format, args...))
+	}
+
+	// Ask every nameserver address (via glue, or the resolver) for NS and
+	// SOA: first the parent's NS set, then names only the zone itself lists.
+	childSet := map[string]bool{}
+	serials := map[uint32][]string{}
+	probed := map[string]bool{}
+	probe := func(host string) {
+		probed[host] = true
+		addrs := parent.Glue[host]
+		if len(addrs) == 0 {
+			v4, v6 := resolveHost(ctx, client, resolver, host)
+			addrs = append(v4, v6...)
+		}
+		if len(addrs) == 0 {
+			finding("lame: %s heeft geen glue en resolvet niet naar A/AAAA", host)
+			return
+		}
+		addrs, skipped := reachableAddrs(addrs)
+		for _, ip := range skipped {
+			rep.Unreachable = append(rep.Unreachable, fmt.Sprintf("%s (%s): geen IPv6 route", host, ip))
+		}
+		for _, ip := range addrs {
+			c := probeNameserver(ctx, client, host, ip, domain)
+			rep.Servers = append(rep.Servers, c)
+			switch {
+			case c.Unreachable:
+				rep.Unreachable = append(rep.Unreachable, fmt.Sprintf("%s (%s): %s", host, ip, c.Error))
+				continue
+			case c.Error != "":
+				finding("lame: %s (%s): %s", host, ip, c.Error)
+				continue
+			case !c.Authoritative:
+				finding("lame: %s (%s) antwoordt niet authoritative voor %s", host, ip, domain)
+				continue
+			}
+			for _, ns := range c.NS {
+				childSet[ns] = true
+			}
+			serials[c.Serial] = append(serials[c.Serial], host+" ("+ip+")")
+		}
+	}
+	for _, host := range parent.NS {
+		probe(host)
+	}
+	for _, host := range sortedKeys(childSet) {
+		if !probed[host] {
+			probe(host)
+		}
+	}
+	rep.ChildNS = sortedKeys(childSet)
+
+	// The NS sets on both sides of the zone cut must match.
+	parentSet := map[string]bool{}
+	for _, ns := range parent.NS {
+		parentSet[ns] = true
+	}
+	for _, ns := range parent.NS {
+		if len(childSet) > 0 && !childSet[ns] {
+			finding("mismatch: %s staat bij de parent maar niet in de zone zelf", ns)
+		}
+	}
+	for _, ns := range rep.ChildNS {
+		if !parentSet[ns] {
+			finding("mismatch: %s staat in de zone maar niet bij de parent (%s)", ns, parent.Parent)
+		}
+	}
+	for _, c := range rep.Servers {
+		if c.Error != "" || !c.Authoritative {
+			continue
+		}
+		if strings.Join(c.NS, ",") != strings.Join(rep.ChildNS, ",") {
+			finding("inconsistent: %s (%s) serveert NS set [%s]", c.Host, c.IP, strings.Join(c.NS, ", "))
+		}
+	}
+	if len(serials) > 1 {
+		var parts []string
+		for serial, hosts := range serials {
+			parts = append(parts, fmt.Sprintf("%d: %s", serial, strings.Join(hosts, ", ")))
+		}
+		sort.Strings(parts)
+		finding("SOA serials verschillen tussen nameservers (%s)", strings.Join(parts, "; "))
+	}
+
+	// Glue: required for in-bailiwick names, and it must match the
+	// addresses the child itself publishes for those names.
+	authServer := ""
+	for _, c := range rep.Servers {
+		if c.Error == "" && c.Authoritative {
+			authServer = net.JoinHostPort(c.IP, "53")
+			break
+		}
+	}
+	for _, host := range sortedKeys(mergeSets(parentSet, childSet)) {
+		glue := parent.Glue[host]
+		if !inBailiwick(host, domain) {
+			continue
+		}
+		if parentSet[host] && len(glue) == 0 {
+			finding("glue ontbreekt: %s ligt binnen %s maar de parent geeft geen glue", host, domain)
+			continue
+		}
+		if authServer == "" || len(glue) == 0 {
+			continue
+		}
+		live := authoritativeAddrs(ctx, client, authServer, host)
+		sort.Strings(glue)
+		if strings.Join(glue, ",") != strings.Join(live, ",") {
+			finding("verouderde glue: %s parent [%s], zone [%s]", host, strings.Join(glue, ", "), orDash(live))
+		}
+	}
+
+	// RFC 2181 section 10.3: NS targets must not be aliases.
+	for _, host := range sortedKeys(mergeSets(parentSet, childSet)) {
+		rrs, err := queryType(ctx, client, resolver, host, dns.TypeCNAME)
+		if err != nil {
+			continue
+		}
+		for _, rr := range rrs {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, dns.Fqdn(host)) {
+				finding("NS %s is een CNAME naar %s (niet toegestaan, RFC 2181)", host, strings.TrimSuffix(c.Target, "."))
+			}
+		}
+	}
+	return rep, nil
+}
+
+func mergeSets(a, b map[string]bool) map[string]bool {
+	out := map[string]bool{}
+	for k := range a {
+		out[k] = true
+	}
+	for k := range b {
+		out[k] = true
+	}
+	return out
+}
+
+// probeNameserver asks one nameserver address for the NS and SOA of domain.
+func probeNameserver(ctx context.Context, client *dns.Client, host, ip, domain string) nsServerCheck {
+	c := nsServerCheck{Host: host, IP: ip}
+	server := net.JoinHostPort(ip, "53")
+
+	in, err := queryAuth(ctx, client, server, domain, dns.TypeNS)
+	if err != nil {
+		c.Error, c.Unreachable = err.Error(), transportError(err)
+		return c
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		c.Error = "rcode " + dns.RcodeToString[in.Rcode]
+		return c
+	}
+	c.Authoritative = in.Authoritative
+	for _, rr := range in.Answer {
+		if v, ok := rr.(*dns.NS); ok && strings.EqualFold(v.Hdr.Name, dns.Fqdn(domain)) {
+			c.NS = append(c.NS, strings.ToLower(strings.TrimSuffix(v.Ns, ".")))
+		}
+	}
+	sort.Strings(c.NS)
+
+	if soa, err := queryAuth(ctx, client, server, domain, dns.TypeSOA); err == nil {
+		for _, rr := range soa.Answer {
+			if v, ok := rr.(*dns.SOA); ok {
+				c.Serial = v.Serial
+			}
+		}
+	}
+	return c
+}
+
+// authoritativeAddrs asks an authoritative server for the A/AAAA of host.
+func authoritativeAddrs(ctx context.Context, client *dns.Client, server, host string) []string {
+	var out []string
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		in, err := queryAuth(ctx, client, server, host, qtype)
+		if err != nil {
+			continue
+		}
+		out = append(out, extractIPs(in.Answer)...)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func printDelegation(rep *delegationReport) {
+	p := rep.Parent
+	fmt.Printf("Parent zone: %s (gevraagd aan %s, NS TTL %d)\n", p.Parent, p.Server, p.NSTTL)
+	fmt.Println("NS bij parent:")
+	for _, ns := range p.NS {
+		if glue := p.Glue[ns]; len(glue) > 0 {
+			fmt.Printf("  - %s (glue: %s)\n", ns, strings.Join(glue, ", "))
+		} else {
+			fmt.Printf("  - %s\n", ns)
+		}
+	}
+	fmt.Printf("NS in de zone: %s\n", orDash(rep.ChildNS))
+	fmt.Println("Nameservers:")
+	for _, c := range rep.Servers {
+		switch {
+		case c.Unreachable:
+			// Listed below.
+		case c.Error != "":
+			fmt.Printf("  - %s (%s): error: %s\n", c.Host, c.IP, c.Error)
+		case !c.Authoritative:
+			fmt.Printf("  - %s (%s): NIET authoritative\n", c.Host, c.IP)
+		default:
+			fmt.Printf("  - %s (%s): AA, serial %d\n", c.Host, c.IP, c.Serial)
+		}
+	}
+	if len(rep.Unreachable) > 0 {
+		fmt.Println("Niet bereikbaar vanaf hier (geen bevinding):")
+		for _, u := range rep.Unreachable {
+			fmt.Printf("  - %s\n", u)
+		}
+	}
+	if len(rep.Findings) == 0 {
+		fmt.Println("Delegatie is consistent")
+		return
+	}
+	fmt.Println("Bevindingen:")
+	for _, f := range rep.Findings {
+		fmt.Printf("  [!] %s\n", f)
+	}
+}
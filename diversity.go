@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// infraHost is one NS or MX host with its addresses and origin ASNs.
+type infraHost struct {
+	Host string   `json:"host"`
+	IPv4 []string `json:"ipv4,omitempty"`
+	IPv6 []string `json:"ipv6,omitempty"`
+	ASNs []uint32 `json:"asns,omitempty"`
+	Glue []string `json:"glue,omitempty"`
+}
+
+type diversityReport struct {
+	NS       []infraHost `json:"ns"`
+	MX       []infraHost `json:"mx"`
+	Glue     string      `json:"glue_source,omitempty"` // parent server the glue came from
+	Findings []string    `json:"findings,omitempty"`
+}
+
+// analyseDiversity looks for single points of failure in the NS and MX sets
+// of a report: one host, one prefix, one ASN or no IPv6 at all. For NS hosts
+// inside the zone it also compares the parent glue with the live addresses.
+func analyseDiversity(ctx context.Context, client *dns.Client, resolver string, r *dnsReport, enricher ipEnricher) *diversityReport {
+	d := &diversityReport{}
+
+	var nsHosts []string
+	for _, q := range r.Queries {
+		if q.Type != "NS" {
+			continue
+		}
+		for _, rr := range q.RRs() {
+			if v, ok := rr.(*dns.NS); ok {
+				nsHosts = append(nsHosts, strings.ToLower(strings.TrimSuffix(v.Ns, ".")))
+			}
+		}
+	}
+	for _, h := range nsHosts {
+		v4, v6 := resolveHost(ctx, client, resolver, h)
+		d.NS = append(d.NS, infraHost{Host: h, IPv4: v4, IPv6: v6})
+	}
+	if r.Mail != nil {
+		for _, mx := range r.Mail.MX {
+			h := infraHost{Host: mx.Host}
+			for _, ip := range mx.IPs {
+				if strings.Contains(ip, ":") {
+					h.IPv6 = append(h.IPv6, ip)
+				} else {
+					h.IPv4 = append(h.IPv4, ip)
+				}
+			}
+			d.MX = append(d.MX, h)
+		}
+	}
+
+	if enricher != nil {
+		owners := map[string]ipInfo{}
+		for _, info := range r.IPs {
+			owners[info.IP] = info
+		}
+		for _, set := range [][]infraHost{d.NS, d.MX} {
+			for i := range set {
+				for _, ip := range append(set[i].IPv4, set[i].IPv6...) {
+					info, ok := owners[ip]
+					if !ok {
+						info = enricher.lookupIP(ctx, ip)
+						owners[ip] = info
+					}
+					if info.ASN != 0 && !containsASN(set[i].ASNs, info.ASN) {
+						set[i].ASNs = append(set[i].ASNs, info.ASN)
+					}
+				}
+			}
+		}
+	}
+
+	d.Findings = append(d.Findings, diversityFindings("NS", d.NS, enricher != nil)...)
+	if r.Mail != nil && len(d.MX) > 0 {
+		d.Findings = append(d.Findings, diversityFindings("MX", d.MX, enricher != nil)...)
+	}
+	d.Findings = append(d.Findings, glueFindings(ctx, client, resolver, r.Domain, d)...)
+	return d
+}
+
+func containsASN(list []uint32, asn uint32) bool {
+	for _, a := range list {
+		if a == asn {
+			return true
+		}
+	}
+	return false
+}
+
+func diversityFindings(set string, hosts []infraHost, haveASN bool) []string {
+	var out []string
+	if len(hosts) == 0 {
+		return []string{fmt.Sprintf("%s: geen hosts gevonden", set)}
+	}
+	if len(hosts) == 1 {
+		out = append(out, fmt.Sprintf("%s: slechts één host (%s)", set, hosts[0].Host))
+	}
+
+	v4Prefixes := map[string]bool{}
+	v6Prefixes := map[string]bool{}
+	asns := map[uint32]bool{}
+	hasV6 := false
+	allASNKnown := haveASN
+	for _, h := range hosts {
+		if len(h.IPv4) == 0 && len(h.IPv6) == 0 {
+			out = append(out, fmt.Sprintf("%s: %s resolvet niet naar A/AAAA", set, h.Host))
+			continue
+		}
+		for _, ip := range h.IPv4 {
+			v4Prefixes[ipPrefix(ip, 24)] = true
+		}
+		for _, ip := range h.IPv6 {
+			v6Prefixes[ipPrefix(ip, 48)] = true
+			hasV6 = true
+		}
+		if len(h.ASNs) == 0 {
+			allASNKnown = false
+		}
+		for _, a := range h.ASNs {
+			asns[a] = true
+		}
+	}
+
+	if !hasV6 {
+		out = append(out, fmt.Sprintf("%s: geen enkele host is bereikbaar via IPv6", set))
+	}
+	if len(hosts) > 1 {
+		if len(v4Prefixes) == 1 {
+			out = append(out, fmt.Sprintf("%s: alle IPv4 adressen zitten in dezelfde /24 (%s)", set, sortedKeys(v4Prefixes)[0]))
+		}
+		if len(v6Prefixes) == 1 {
+			out = append(out, fmt.Sprintf("%s: alle IPv6 adressen zitten in dezelfde /48 (%s)", set, sortedKeys(v6Prefixes)[0]))
+		}
+		if allASNKnown && len(asns) == 1 {
+			for a := range asns {
+				out = append(out, fmt.Sprintf("%s: alle hosts zitten in hetzelfde netwerk (AS%d)", set, a))
+			}
+		}
+	}
+	return out
+}
+
+func ipPrefix(ip string, bits int) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	size := 128
+	if v4 := addr.To4(); v4 != nil {
+		addr, size = v4, 32
+	}
+	n := &net.IPNet{IP: addr.Mask(net.CIDRMask(bits, size)), Mask: net.CIDRMask(bits, size)}
+	return n.String()
+}
+
+// glueFindings compares parent glue with the addresses the in-bailiwick
+// nameservers actually resolve to.
+func glueFindings(ctx context.Context, client *dns.Client, resolver, domain string, d *diversityReport) []string {
+	needGlue := false
+	for _, h := range d.NS {
+		if inBailiwick(h.Host, domain) {
+			needGlue = true
+		}
+	}
+	if !needGlue {
+		return nil
+	}
+
+	del, err := parentDelegation(ctx, client, resolver, domain)
+	if err != nil {
+		return []string{fmt.Sprintf("glue: parent niet te bevragen: %v", err)}
+	}
+	d.Glue = del.Server
+
+	var out []string
+	for i, h := range d.NS {
+		if !inBailiwick(h.Host, domain) {
+			continue
+		}
+		glue := del.Glue[h.Host]
+		d.NS[i].Glue = glue
+		if len(glue) == 0 {
+			out = append(out, fmt.Sprintf("glue: %s staat in de zone maar de parent (%s) geeft geen glue", h.Host, del.Server))
+			continue
+		}
+		live := append(append([]string{}, h.IPv4...), h.IPv6...)
+		sort.Strings(glue)
+		sort.Strings(live)
+		if strings.Join(glue, ",") != strings.Join(live, ",") {
+			out = append(out, fmt.Sprintf("glue: %s parent glue [%s] wijkt af van live [%s]", h.Host, strings.Join(glue, ", "), strings.Join(live, ", ")))
+		}
+	}
+	return out
+}
+
+func printDiversity(d *diversityReport) {
+	for _, set := range []struct {
+		name  string
+		hosts []infraHost
+	}{{"NS", d.NS}, {"MX", d.MX}} {
+		if len(set.hosts) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", set.name)
+		for _, h := range set.hosts {
+			fmt.Printf("  - %s\n", h.Host)
+			fmt.Printf("    IPv4: %s | IPv6: %s\n", orDash(h.IPv4), orDash(h.IPv6))
+			if len(h.ASNs) > 0 {
+				asns := make([]string, 0, len(h.ASNs))
+				for _, a := range h.ASNs {
+					asns = append(asns, fmt.Sprintf("AS%d", a))
+				}
+				fmt.Printf("    ASN: %s\n", strings.Join(asns, ", "))
+			}
+			if len(h.Glue) > 0 {
+				fmt.Printf("    glue (%s): %s\n", d.Glue, strings.Join(h.Glue, ", "))
+			}
+		}
+	}
+	if len(d.Findings) == 0 {
+		fmt.Println("Geen single points of failure gevonden")
+		return
+	}
+	fmt.Println("Bevindingen:")
+	for _, f := range d.Findings {
+		fmt.Printf("  [!] %s\n", f)
+	}
+}
+
+func orDash(list []string) string {
+	if len(list) == 0 {
+		return "-"
+	}
+	return strings.Join(list, ", ")
+}
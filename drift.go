@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsSource is where live answers come from: one authoritative server
+// (queried without recursion) or a recursive resolver.
+type dnsSource struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Recursive bool   `json:"recursive,omitempty"`
+}
+
+func (s dnsSource) String() string {
+	if host, _, _ := net.SplitHostPort(s.Addr); s.Name == "" || s.Name == s.Addr || s.Name == host {
+		return s.Addr
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, s.Addr)
+}
+
+// lookup returns the RRset for name/qtype at the source. NXDOMAIN and
+// NODATA are empty answers; other rcodes are errors. An authoritative
+// server answers NS queries for a delegation with a referral, so for NS
+// the authority section counts as well.
+func (s dnsSource) lookup(ctx context.Context, client *dns.Client, name string, qtype uint16) ([]dns.RR, error) {
+	rrs, err := s.answer(ctx, client, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	var out []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, dns.Fqdn(name)) {
+			out = append(out, rr)
+		}
+	}
+	return out, nil
+}
+
+// answer returns the unfiltered answer of the source for name/qtype, with
+// a delegation's NS set from the authority section.
+func (s dnsSource) answer(ctx context.Context, client *dns.Client, name string, qtype uint16) ([]dns.RR, error) {
+	if s.Recursive {
+		return queryType(ctx, client, s.Addr, name, qtype)
+	}
+	in, err := queryAuth(ctx, client, s.Addr, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if err := answerError(in, nil); err != nil {
+		return nil, err
+	}
+	if qtype == dns.TypeNS && len(in.Answer) == 0 {
+		return in.Ns, nil
+	}
+	return in.Answer, nil
+}
+
+// authSources returns the servers to compare against: the given servers
+// (host or IP, optional port) or else every address of the zone's live NS set.
+func authSources(ctx context.Context, client *dns.Client, resolver, zone string, servers []string) ([]dnsSource, error) {
+	if len(servers) == 0 {
+		rrs, err := queryType(ctx, client, resolver, zone, dns.TypeNS)
+		if err != nil {
+			return nil, fmt.Errorf("NS van %s: %w", zone, err)
+		}
+		for _, rr := range rrs {
+			if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, dns.Fqdn(zone)) {
+				servers = append(servers, strings.TrimSuffix(ns.Ns, "."))
+			}
+		}
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("geen NS records gevonden voor %s", zone)
+		}
+	}
+
+	var out []dnsSource
+	for _, s := range servers {
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			host, port = s, "53"
+		}
+		if net.ParseIP(host) != nil {
+			out = append(out, dnsSource{Name: host, Addr: net.JoinHostPort(host, port)})
+			continue
+		}
+		v4, v6 := resolveHost(ctx, client, resolver, host)
+		if len(v4)+len(v6) == 0 {
+			return nil, fmt.Errorf("nameserver %s resolvet niet", host)
+		}
+		// Without an IPv6 route every AAAA address would only add errors.
+		addrs, skipped := reachableAddrs(append(v4, v6...))
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("nameserver %s heeft alleen IPv6 adressen en er is geen IPv6 route", host)
+		}
+		if len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: IPv6 adressen overgeslagen (geen IPv6 route): %s\n", host, strings.Join(skipped, ", "))
+		}
+		for _, ip := range addrs {
+			out = append(out, dnsSource{Name: host, Addr: net.JoinHostPort(ip, port)})
+		}
+	}
+	return out, nil
+}
+
+// rrsetDiff compares two RRsets by data. TTLs are only compared when both
+// sides are authoritative; a resolver's cache counts them down. For SOA the
+// serial is reported on its own, so a pending zone transfer reads as such.
+func rrsetDiff(expected, live []dns.RR, compareTTL bool) (missing, extra []dns.RR, detail string) {
+	strip := func(rr dns.RR) dns.RR {
+		if soa, ok := rr.(*dns.SOA); ok {
+			c := *soa
+			c.Serial = 0
+			return &c
+		}
+		return rr
+	}
+	contains := func(set []dns.RR, rr dns.RR) bool {
+		for _, o := range set {
+			if dns.IsDuplicate(strip(o), strip(rr)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range expected {
+		if !contains(live, rr) {
+			missing = append(missing, rr)
+		}
+	}
+	for _, rr := range live {
+		if !contains(expected, rr) {
+			extra = append(extra, rr)
+		}
+	}
+	if len(missing) > 0 || len(extra) > 0 || len(expected) == 0 || len(live) == 0 {
+		return missing, extra, ""
+	}
+
+	var notes []string
+	if a, ok := expected[0].(*dns.SOA); ok {
+		if b := live[0].(*dns.SOA); a.Serial != b.Serial {
+			notes = append(notes, fmt.Sprintf("serial %d -> %d", a.Serial, b.Serial))
+		}
+	}
+	if compareTTL && expected[0].Header().Ttl != live[0].Header().Ttl {
+		notes = append(notes, fmt.Sprintf("TTL %d -> %d", expected[0].Header().Ttl, live[0].Header().Ttl))
+	}
+	return nil, nil, strings.Join(notes, ", ")
+}
+
+// driftFinding is one RRset that differs between the zone file and a source.
+type driftFinding struct {
+	Source   string   `json:"source"`
+	Owner    string   `json:"owner"`
+	Type     string   `json:"type"`
+	Kind     string   `json:"kind"` // missing, extra, different or error
+	Expected []string `json:"expected,omitempty"`
+	Live     []string `json:"live,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func (f driftFinding) String() string {
+	key := f.Owner + " " + f.Type
+	switch f.Kind {
+	case "missing":
+		return fmt.Sprintf("- %s ontbreekt live: %s", key, strings.Join(f.Expected, " | "))
+	case "extra":
+		return fmt.Sprintf("+ %s extra live: %s", key, strings.Join(f.Live, " | "))
+	case "error":
+		return fmt.Sprintf("! %s: %s", key, f.Detail)
+	}
+	if f.Detail != "" && len(f.Expected) == 0 {
+		return fmt.Sprintf("~ %s: %s", key, f.Detail)
+	}
+	return fmt.Sprintf("~ %s verschilt: zone [%s] live [%s]", key, strings.Join(f.Expected, " | "), strings.Join(f.Live, " | "))
+}
+
+func rrDataList(rrs []dns.RR) []string {
+	out := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		out = append(out, rrData(rr))
+	}
+	return out
+}
+
+// driftSkipTypes are maintained by the signer, not by the zone file.
+var driftSkipTypes = map[uint16]bool{dns.TypeRRSIG: true, dns.TypeNSEC: true, dns.TypeNSEC3: true}
+
+// driftProbeTypes are also queried at every owner in the file, to find
+// RRsets that exist live but not in the file.
+var driftProbeTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeTXT, dns.TypeCAA, dns.TypeSRV}
+
+// zoneRRsets groups a zone by owner and type. Names below a delegation are
+// glue; they are answered with a referral and are left out.
+func zoneRRsets(apex string, rrs []dns.RR) map[string]map[uint16][]dns.RR {
+	cuts := map[string]bool{}
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeNS && !strings.EqualFold(h.Name, apex) {
+			cuts[strings.ToLower(h.Name)] = true
+		}
+	}
+	below := func(name string) bool {
+		for cut := range cuts {
+			if name != cut && dns.IsSubDomain(cut, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	sets := map[string]map[uint16][]dns.RR{}
+	for _, rr := range rrs {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		if driftSkipTypes[h.Rrtype] || !dns.IsSubDomain(apex, name) || below(name) {
+			continue
+		}
+		if cuts[name] && h.Rrtype != dns.TypeNS && h.Rrtype != dns.TypeDS {
+			continue
+		}
+		if sets[name] == nil {
+			sets[name] = map[uint16][]dns.RR{}
+		}
+		sets[name][h.Rrtype] = append(sets[name][h.Rrtype], rr)
+	}
+	return sets
+}
+
+// checkDrift compares every RRset in the zone with one source.
+func checkDrift(ctx context.Context, client *dns.Client, src dnsSource, apex string, sets map[string]map[uint16][]dns.RR) []driftFinding {
+	var out []driftFinding
+	for _, name := range sortedNames(sets) {
+		types := map[uint16]bool{}
+		for t := range sets[name] {
+			types[t] = true
+		}
+		delegation := len(sets[name][dns.TypeNS]) > 0 && name != apex
+		if !delegation {
+			for _, t := range driftProbeTypes {
+				types[t] = true
+			}
+		}
+
+		for _, t := range sortedTypeSet(types) {
+			// The apex DS lives in the parent zone, not on these servers.
+			if t == dns.TypeDS && name == apex {
+				continue
+			}
+			expected := sets[name][t]
+			live, err := src.lookup(ctx, client, name, t)
+			f := driftFinding{Source: src.String(), Owner: name, Type: dns.TypeToString[t]}
+			if err != nil {
+				f.Kind, f.Detail = "error", err.Error()
+				out = append(out, f)
+				continue
+			}
+			missing, extra, detail := rrsetDiff(expected, live, !src.Recursive)
+			switch {
+			case len(expected) > 0 && len(live) == 0:
+				f.Kind, f.Expected = "missing", rrDataList(expected)
+			case len(expected) == 0 && len(live) > 0:
+				f.Kind, f.Live = "extra", rrDataList(live)
+			case len(missing) > 0 || len(extra) > 0:
+				f.Kind, f.Expected, f.Live = "different", rrDataList(expected), rrDataList(live)
+			case detail != "":
+				f.Kind, f.Detail = "different", detail
+			default:
+				continue
+			}
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func sortedTypeSet(m map[uint16]bool) []uint16 {
+	sets := make(map[uint16][]dns.RR, len(m))
+	for t := range m {
+		sets[t] = nil
+	}
+	return sortedTypes(sets)
+}
+
+// runDriftCmd implements "ultradns drift". Exit codes: 0 live matches the
+// file, 1 drift or query errors, 2 usage or parse error.
+func runDriftCmd(args []string) int {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	var origin, resolverFlag, via string
+	var servers stringList
+	var asJSON bool
+	var timeout time.Duration
+	fs.StringVar(&origin, "origin", "", "Zone origin als het bestand geen $ORIGIN heeft")
+	fs.Var(&servers, "server", "Vergelijk met deze nameserver(s) i.p.v. de live NS set (host of ip[:port], komma-gescheiden of herhaalbaar)")
+	fs.StringVar(&via, "via", "", "Vergelijk via deze recursieve resolver (ip[:port]) i.p.v. de authoritative servers")
+	fs.StringVar(&resolverFlag, "r", "", "Resolver voor het opzoeken van de NS set. Default: systeem resolvers of 8.8.8.8:53")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Timeout per query")
+	fs.BoolVar(&asJSON, "json", false, "Output als JSON")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns drift [-server ns1.example.com] [-via 1.1.1.1] <zone.db>\n\n")
+		fmt.Fprintf(os.Stderr, "Vergelijkt een zone file met wat live geserveerd wordt: ontbrekende, extra en afwijkende records.\n")
+		fmt.Fprintf(os.Stderr, "Standaard wordt elke authoritative server van de zone apart bevraagd.\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = geen verschillen, 1 = verschillen of fouten, 2 = fout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	rrs, apex, err := loadZoneFile(fs.Arg(0), origin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	sets := zoneRRsets(apex, rrs)
+
+	// The servers are queried in parallel, each one name after the other,
+	// so the budget grows with the zone: enough for every query on one
+	// server to time out, plus a minute for finding the servers.
+	queries := 0
+	for _, types := range sets {
+		queries += len(types) + len(driftProbeTypes)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute+time.Duration(queries)*timeout)
+	defer cancel()
+	client := &dns.Client{Timeout: timeout}
+	resolver := pickResolver(resolverFlag)
+
+	var sources []dnsSource
+	if via != "" {
+		addr := pickResolver(via)
+		sources = []dnsSource{{Name: addr, Addr: addr, Recursive: true}}
+	} else if sources, err = authSources(ctx, client, resolver, apex, servers); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	perSource := make([][]driftFinding, len(sources))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perSource[i] = checkDrift(ctx, client, src, apex, sets)
+		}()
+	}
+	wg.Wait()
+
+	var all []driftFinding
+	for i, src := range sources {
+		findings := perSource[i]
+		all = append(all, findings...)
+		if asJSON {
+			continue
+		}
+		printHeader(fmt.Sprintf("DRIFT %s vs %s", fs.Arg(0), src))
+		if len(findings) == 0 {
+			fmt.Printf("Geen verschillen (%d namen)\n", len(sets))
+		}
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		fmt.Println()
+	}
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, map[string]any{"zone": apex, "sources": sources, "findings": all}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	}
+	if len(all) > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Statuses of a subdomain in the inventory.
+const (
+	subLive          = "live"
+	subCNAMEExternal = "cname-external"
+	subNoAddress     = "no-address"
+	subNXDomain      = "nxdomain"
+	subError         = "error"
+)
+
+// subdomainStatusOrder is the order of the groups in the text output.
+var subdomainStatusOrder = []struct{ status, title string }{
+	{subLive, "live"},
+	{subCNAMEExternal, "CNAME naar extern"},
+	{subNoAddress, "bestaat, geen A/AAAA"},
+	{subNXDomain, "NXDOMAIN"},
+	{subError, "fout"},
+}
+
+// subdomainInfo is what a discovered name resolves to now.
+type subdomainInfo struct {
+	Name   string      `json:"name"`
+	Status string      `json:"status"`
+	CNAME  string      `json:"cname,omitempty"`
+	IPs    []string    `json:"ips,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	HTTP   []httpProbe `json:"http,omitempty"`
+}
+
+// httpProbe is one HTTP(S) request to a live name.
+type httpProbe struct {
+	URL      string `json:"url"`
+	Status   int    `json:"status,omitempty"`
+	Location string `json:"location,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// classifySubdomains resolves every name on a pool of workers. A CNAME is
+// external when its target is outside domain; the addresses are then those
+// of the target.
+func classifySubdomains(ctx context.Context, client *dns.Client, resolver, domain string, names []string, workers int, probeHTTP bool) []subdomainInfo {
+	if workers < 1 {
+		workers = 1
+	}
+	apex := dns.Fqdn(strings.ToLower(domain))
+	out := make([]subdomainInfo, len(names))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out[i] = classifySubdomain(ctx, client, resolver, apex, names[i], probeHTTP)
+			}
+		}()
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(out, func(i, j int) bool { return zoneNameLess(dns.Fqdn(out[i].Name), dns.Fqdn(out[j].Name)) })
+	return out
+}
+
+func classifySubdomain(ctx context.Context, client *dns.Client, resolver, apex, name string, probeHTTP bool) subdomainInfo {
+	info := subdomainInfo{Name: name}
+	h, exists, err := bruteLookup(ctx, client, resolver, dns.Fqdn(name))
+	info.CNAME, info.IPs = strings.TrimSuffix(h.CNAME, "."), h.IPs
+	switch {
+	case err != nil:
+		info.Status, info.Error = subError, err.Error()
+	case !exists:
+		info.Status = subNXDomain
+	case h.CNAME != "" && !dns.IsSubDomain(apex, h.CNAME):
+		info.Status = subCNAMEExternal
+	case len(h.IPs) > 0:
+		info.Status = subLive
+	default:
+		info.Status = subNoAddress
+	}
+	if probeHTTP && len(info.IPs) > 0 {
+		info.HTTP = probeHTTPS(ctx, name, info.IPs[0])
+	}
+	return info
+}
+
+// probeClient returns the client for the liveness probes of one name. It
+// connects to ip, the address the resolver gave, instead of resolving the
+// name again through the system resolver. Certificates are not verified:
+// the question is whether something answers, and a name with a broken
+// certificate is exactly what an inventory should show.
+func probeClient(ip string) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			},
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		// Redirects are not followed: they may lead to another host, which
+		// the dialer would still send to ip.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// probeHTTPS requests https:// and http:// for host at ip and records the
+// status, the redirect target and the page title.
+func probeHTTPS(ctx context.Context, host, ip string) []httpProbe {
+	client := probeClient(ip)
+	defer client.CloseIdleConnections()
+	var out []httpProbe
+	for _, scheme := range []string{"https", "http"} {
+		p, body := fetchProbe(ctx, client, scheme+"://"+host+"/")
+		if m := titleRe.FindSubmatch(body); m != nil {
+			p.Title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+			if len(p.Title) > 80 {
+				p.Title = p.Title[:77] + "..."
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// fetchProbe requests url and returns the result with the first 64 KiB of
+// the body.
+func fetchProbe(ctx context.Context, client *http.Client, url string) (httpProbe, []byte) {
+	p := httpProbe{URL: url}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		p.Error = err.Error()
+		return p, nil
+	}
+	req.Header.Set("User-Agent", "ultradns/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		p.Error = err.Error()
+		return p, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	p.Status = resp.StatusCode
+	p.Location = resp.Header.Get("Location")
+	return p, body
+}
+
+func printSubdomainInventory(infos []subdomainInfo) {
+	groups := map[string][]subdomainInfo{}
+	for _, info := range infos {
+		groups[info.Status] = append(groups[info.Status], info)
+	}
+	for _, g := range subdomainStatusOrder {
+		list := groups[g.status]
+		if len(list) == 0 {
+			continue
+		}
+		fmt.Printf("\n-- %s (%d) --\n", g.title, len(list))
+		for _, info := range list {
+			line := info.Name
+			if info.Status == subError {
+				line = "[!] " + line
+			}
+			if info.CNAME != "" {
+				line += " -> " + info.CNAME
+			}
+			if len(info.IPs) > 0 {
+				line += " " + strings.Join(info.IPs, ", ")
+			}
+			if info.Error != "" {
+				line += ": " + info.Error
+			}
+			fmt.Println(line)
+			for _, p := range info.HTTP {
+				switch {
+				case p.Error != "":
+					fmt.Printf("    %s: %s\n", p.URL, p.Error)
+				case p.Location != "":
+					fmt.Printf("    %s: %d -> %s\n", p.URL, p.Status, p.Location)
+				case p.Title != "":
+					fmt.Printf("    %s: %d %q\n", p.URL, p.Status, p.Title)
+				default:
+					fmt.Printf("    %s: %d\n", p.URL, p.Status)
+				}
+			}
+		}
+	}
+}
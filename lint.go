@@ -0,0 +1,736 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// lintFinding is one problem found by a lint rule.
+type lintFinding struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity"`
+	Owner       string `json:"owner"`
+	Type        string `json:"type,omitempty"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+func (f lintFinding) String() string {
+	owner := f.Owner
+	if f.Type != "" {
+		owner += " " + f.Type
+	}
+	return fmt.Sprintf("%-7s %s [%s] %s", f.Severity, owner, f.ID, f.Message)
+}
+
+const (
+	sevInfo    = "info"
+	sevWarning = "warning"
+	sevError   = "error"
+)
+
+var severityRank = map[string]int{sevInfo: 0, sevWarning: 1, sevError: 2}
+
+// lintZoneData is what the rules look at: the records of one zone grouped
+// by owner and type. Hosts holds what is known about MX/NS targets outside
+// the zone and is only filled in live mode.
+type lintZoneData struct {
+	Apex      string
+	ByName    map[string]map[uint16][]dns.RR
+	OutOfZone []dns.RR
+	Hosts     map[string]lintHost
+
+	// LongStrings are TXT strings over 255 bytes in the zone file source.
+	// The parser splits those silently, so the records can't show them.
+	LongStrings []longString
+}
+
+// longString is a quoted string over 255 bytes in a zone file.
+type longString struct {
+	Owner string
+	Line  int
+	Len   int
+}
+
+// lintHost describes an MX or NS target.
+type lintHost struct {
+	V4, V6 bool
+	CNAME  string
+}
+
+func newLintZoneData(apex string, rrs []dns.RR) *lintZoneData {
+	z := &lintZoneData{Apex: dns.Fqdn(strings.ToLower(apex)), ByName: map[string]map[uint16][]dns.RR{}}
+	for _, rr := range rrs {
+		h := rr.Header()
+		h.Name = strings.ToLower(h.Name)
+		if !dns.IsSubDomain(z.Apex, h.Name) {
+			z.OutOfZone = append(z.OutOfZone, rr)
+			continue
+		}
+		if z.ByName[h.Name] == nil {
+			z.ByName[h.Name] = map[uint16][]dns.RR{}
+		}
+		z.ByName[h.Name][h.Rrtype] = append(z.ByName[h.Name][h.Rrtype], rr)
+	}
+	return z
+}
+
+func (z *lintZoneData) has(name string, t uint16) bool {
+	return len(z.ByName[strings.ToLower(name)][t]) > 0
+}
+
+// host returns what is known about a target, from the zone itself or from
+// the live lookups. ok is false when nothing is known.
+func (z *lintZoneData) host(name string) (h lintHost, ok bool) {
+	name = strings.ToLower(name)
+	if dns.IsSubDomain(z.Apex, name) {
+		if cn := z.ByName[name][dns.TypeCNAME]; len(cn) > 0 {
+			h.CNAME = cn[0].(*dns.CNAME).Target
+		}
+		h.V4, h.V6 = z.has(name, dns.TypeA), z.has(name, dns.TypeAAAA)
+		return h, true
+	}
+	h, ok = z.Hosts[name]
+	return h, ok
+}
+
+// targets calls fn for every MX and NS target in the zone.
+func (z *lintZoneData) targets(fn func(owner string, rrtype uint16, target string)) {
+	for _, name := range sortedNames(z.ByName) {
+		for _, rr := range z.ByName[name][dns.TypeMX] {
+			fn(name, dns.TypeMX, strings.ToLower(rr.(*dns.MX).Mx))
+		}
+		for _, rr := range z.ByName[name][dns.TypeNS] {
+			fn(name, dns.TypeNS, strings.ToLower(rr.(*dns.NS).Ns))
+		}
+	}
+}
+
+type lintReporter func(owner string, rrtype uint16, format string, args ...any)
+
+// lintRule is one check. The IDs are stable so they can be used with
+// -rules/-skip and in CI configuration.
+type lintRule struct {
+	ID          string
+	Severity    string
+	Description string
+	Remediation string
+	check       func(z *lintZoneData, report lintReporter)
+}
+
+var lintRules = []lintRule{
+	{
+		ID: "soa-missing", Severity: sevError,
+		Description: "De zone heeft geen SOA record",
+		Remediation: "Voeg een SOA record toe op de apex.",
+		check: func(z *lintZoneData, report lintReporter) {
+			if !z.has(z.Apex, dns.TypeSOA) {
+				report(z.Apex, dns.TypeSOA, "zone heeft geen SOA record")
+			}
+		},
+	},
+	{
+		ID: "ns-missing", Severity: sevError,
+		Description: "De zone heeft geen NS records op de apex",
+		Remediation: "Voeg minimaal twee NS records toe op de apex (RFC 1034 4.1).",
+		check: func(z *lintZoneData, report lintReporter) {
+			if !z.has(z.Apex, dns.TypeNS) {
+				report(z.Apex, dns.TypeNS, "zone heeft geen NS records op de apex")
+			}
+		},
+	},
+	{
+		ID: "out-of-zone", Severity: sevWarning,
+		Description: "Record valt buiten de zone",
+		Remediation: "Verwijder het record of zet het in de juiste zone; servers negeren data buiten de zone.",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, rr := range z.OutOfZone {
+				report(rr.Header().Name, rr.Header().Rrtype, "naam valt buiten de zone %s", z.Apex)
+			}
+		},
+	},
+	{
+		ID: "cname-apex", Severity: sevError,
+		Description: "CNAME op de apex van de zone",
+		Remediation: "Gebruik A/AAAA op de apex, of ALIAS/ANAME/CNAME flattening van je provider (RFC 1912 2.4).",
+		check: func(z *lintZoneData, report lintReporter) {
+			if z.has(z.Apex, dns.TypeCNAME) {
+				report(z.Apex, dns.TypeCNAME, "CNAME op de apex; de apex heeft altijd SOA en NS, dus dit botst")
+			}
+		},
+	},
+	{
+		ID: "cname-multiple", Severity: sevError,
+		Description: "Meerdere CNAME records voor één naam",
+		Remediation: "Laat één CNAME over.",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, name := range sortedNames(z.ByName) {
+				if cn := z.ByName[name][dns.TypeCNAME]; len(cn) > 1 {
+					report(name, dns.TypeCNAME, "%d CNAME records voor dezelfde naam", len(cn))
+				}
+			}
+		},
+	},
+	{
+		ID: "cname-and-other-data", Severity: sevError,
+		Description: "CNAME naast andere records voor dezelfde naam",
+		Remediation: "Verwijder de andere records of vervang de CNAME door de records zelf (RFC 1034 3.6.2, RFC 2181 10.1).",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, name := range sortedNames(z.ByName) {
+				types := z.ByName[name]
+				// At the apex this is cname-apex.
+				if len(types[dns.TypeCNAME]) == 0 || name == z.Apex {
+					continue
+				}
+				for _, t := range sortedTypes(types) {
+					if t != dns.TypeCNAME && t != dns.TypeRRSIG && t != dns.TypeNSEC {
+						report(name, t, "naam heeft een CNAME en ook een %s record", dns.TypeToString[t])
+					}
+				}
+			}
+		},
+	},
+	{
+		ID: "duplicate", Severity: sevWarning,
+		Description: "Dubbel record",
+		Remediation: "Verwijder het duplicaat; servers geven het maar één keer uit.",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, name := range sortedNames(z.ByName) {
+				for _, t := range sortedTypes(z.ByName[name]) {
+					set := z.ByName[name][t]
+					for i := range set {
+						for j := 0; j < i; j++ {
+							if dns.IsDuplicate(set[i], set[j]) {
+								report(name, t, "dubbel record: %s", rrData(set[i]))
+								break
+							}
+						}
+					}
+				}
+			}
+		},
+	},
+	{
+		ID: "ttl-rrset", Severity: sevWarning,
+		Description: "Verschillende TTL's binnen één RRset",
+		Remediation: "Geef alle records van de RRset dezelfde TTL (RFC 2181 5.2).",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, name := range sortedNames(z.ByName) {
+				for _, t := range sortedTypes(z.ByName[name]) {
+					set := z.ByName[name][t]
+					for _, rr := range set[1:] {
+						if rr.Header().Ttl != set[0].Header().Ttl {
+							report(name, t, "TTL's binnen de RRset verschillen (%d en %d)", set[0].Header().Ttl, rr.Header().Ttl)
+							break
+						}
+					}
+				}
+			}
+		},
+	},
+	{
+		ID: "target-ip", Severity: sevError,
+		Description: "MX of NS target is een IP adres",
+		Remediation: "Gebruik een hostnaam met A/AAAA records als target (RFC 1035 3.3.9, 3.3.11).",
+		check: func(z *lintZoneData, report lintReporter) {
+			z.targets(func(owner string, rrtype uint16, target string) {
+				if looksLikeIP(target) {
+					report(owner, rrtype, "target %s is een IP adres, geen hostnaam", target)
+				}
+			})
+		},
+	},
+	{
+		ID: "target-cname", Severity: sevError,
+		Description: "MX of NS target is een CNAME",
+		Remediation: "Laat het record direct naar de canonieke naam wijzen (RFC 2181 10.3).",
+		check: func(z *lintZoneData, report lintReporter) {
+			z.targets(func(owner string, rrtype uint16, target string) {
+				if h, ok := z.host(target); ok && h.CNAME != "" {
+					report(owner, rrtype, "target %s is een CNAME naar %s", target, h.CNAME)
+				}
+			})
+		},
+	},
+	{
+		ID: "target-missing", Severity: sevError,
+		Description: "MX target heeft geen A/AAAA",
+		Remediation: "Voeg A/AAAA records toe voor de mailserver of corrigeer het MX record.",
+		check: func(z *lintZoneData, report lintReporter) {
+			z.targets(func(owner string, rrtype uint16, target string) {
+				// For NS targets this is missing-glue.
+				if rrtype != dns.TypeMX || target == "." || looksLikeIP(target) {
+					return
+				}
+				if h, ok := z.host(target); ok && h.CNAME == "" && !h.V4 && !h.V6 {
+					report(owner, rrtype, "target %s heeft geen A/AAAA", target)
+				}
+			})
+		},
+	},
+	{
+		ID: "missing-glue", Severity: sevError,
+		Description: "Nameserver in de zone zonder A/AAAA (glue)",
+		Remediation: "Voeg A/AAAA records toe voor de nameserver, en glue bij de parent als hij onder de zone valt.",
+		check: func(z *lintZoneData, report lintReporter) {
+			z.targets(func(owner string, rrtype uint16, target string) {
+				// A nameserver below the delegated name (or, at the apex,
+				// anywhere in the zone) needs its addresses in this zone.
+				if rrtype == dns.TypeNS && dns.IsSubDomain(owner, target) && !z.has(target, dns.TypeA) && !z.has(target, dns.TypeAAAA) {
+					report(owner, rrtype, "nameserver %s staat in de zone maar heeft geen A/AAAA (glue)", target)
+				}
+			})
+		},
+	},
+	{
+		ID: "ns-missing-aaaa", Severity: sevWarning,
+		Description: "Nameserver heeft wel A maar geen AAAA",
+		Remediation: "Geef de nameserver een IPv6 adres, zodat de zone ook via IPv6 bereikbaar is.",
+		check: func(z *lintZoneData, report lintReporter) {
+			z.targets(func(owner string, rrtype uint16, target string) {
+				if rrtype != dns.TypeNS || owner != z.Apex {
+					return
+				}
+				if h, ok := z.host(target); ok && h.V4 && !h.V6 {
+					report(owner, rrtype, "nameserver %s heeft geen AAAA record", target)
+				}
+			})
+		},
+	},
+	{
+		ID: "soa-timers", Severity: sevWarning,
+		Description: "SOA timers buiten de aanbevelingen van RFC 1912 2.2",
+		Remediation: "Aanbevolen: refresh 20m-12h, retry kleiner dan refresh, expire 2-4 weken, minimum 5m-1d (RFC 1912 2.2, RFC 2308).",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, rr := range z.ByName[z.Apex][dns.TypeSOA] {
+				soa := rr.(*dns.SOA)
+				if soa.Refresh < 1200 || soa.Refresh > 43200 {
+					report(z.Apex, dns.TypeSOA, "refresh %d valt buiten 1200-43200", soa.Refresh)
+				}
+				if soa.Retry >= soa.Refresh {
+					report(z.Apex, dns.TypeSOA, "retry %d is niet kleiner dan refresh %d", soa.Retry, soa.Refresh)
+				}
+				if soa.Expire < 1209600 || soa.Expire > 2419200 {
+					report(z.Apex, dns.TypeSOA, "expire %d valt buiten 1209600-2419200 (2-4 weken)", soa.Expire)
+				}
+				if soa.Minttl < 300 || soa.Minttl > 86400 {
+					report(z.Apex, dns.TypeSOA, "minimum (negatieve TTL) %d valt buiten 300-86400", soa.Minttl)
+				}
+			}
+		},
+	},
+	{
+		ID: "txt-string-length", Severity: sevError,
+		Description: "TXT string langer dan 255 bytes",
+		Remediation: "Splits de waarde in strings van maximaal 255 bytes (\"deel1\" \"deel2\"); ontvangers plakken ze weer aan elkaar.",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, s := range z.LongStrings {
+				report(s.Owner, dns.TypeTXT, "string van %d bytes (regel %d)", s.Len, s.Line)
+			}
+			for _, name := range sortedNames(z.ByName) {
+				for _, rr := range z.ByName[name][dns.TypeTXT] {
+					for _, s := range rr.(*dns.TXT).Txt {
+						if len(s) > 255 {
+							report(name, dns.TypeTXT, "string van %d bytes", len(s))
+						}
+					}
+				}
+			}
+		},
+	},
+	{
+		ID: "mail-syntax", Severity: sevWarning,
+		Description: "SPF, DMARC of DKIM record met een syntax probleem",
+		Remediation: "Corrigeer het record volgens RFC 7208 (SPF), RFC 7489 (DMARC) of RFC 6376 (DKIM).",
+		check: func(z *lintZoneData, report lintReporter) {
+			for _, name := range sortedNames(z.ByName) {
+				lintTXT(report, name, z.ByName[name][dns.TypeTXT])
+			}
+		},
+	},
+	{
+		ID: "ttl-outlier", Severity: sevInfo,
+		Description: "TTL erg laag, erg hoog of ver van de mediaan van de zone",
+		Remediation: "Controleer of de afwijkende TTL bewust is, bijvoorbeeld tijdelijk verlaagd voor een migratie.",
+		check:       ttlOutliers,
+	},
+}
+
+// lintSelection picks the rules to run: only the listed IDs (all when
+// empty), minus the skipped ones, at or above a severity.
+type lintSelection struct {
+	Only        []string
+	Skip        []string
+	MinSeverity string
+}
+
+func (s lintSelection) rules() ([]lintRule, error) {
+	known := map[string]bool{}
+	for _, r := range lintRules {
+		known[r.ID] = true
+	}
+	only, skip := map[string]bool{}, map[string]bool{}
+	for _, id := range s.Only {
+		only[id] = true
+	}
+	for _, id := range s.Skip {
+		skip[id] = true
+	}
+	for _, id := range append(append([]string{}, s.Only...), s.Skip...) {
+		if !known[id] {
+			return nil, fmt.Errorf("onbekende lint regel %q (zie ultradns lint -list-rules)", id)
+		}
+	}
+	if _, ok := severityRank[s.MinSeverity]; s.MinSeverity != "" && !ok {
+		return nil, fmt.Errorf("onbekende severity %q (info, warning of error)", s.MinSeverity)
+	}
+
+	var out []lintRule
+	for _, r := range lintRules {
+		if (len(only) > 0 && !only[r.ID]) || skip[r.ID] || severityRank[r.Severity] < severityRank[s.MinSeverity] {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// runLintRules runs rules on z; findings come out in rule order.
+func runLintRules(z *lintZoneData, rules []lintRule) []lintFinding {
+	var out []lintFinding
+	for _, r := range rules {
+		r := r
+		r.check(z, func(owner string, rrtype uint16, format string, args ...any) {
+			f := lintFinding{ID: r.ID, Severity: r.Severity, Owner: owner, Message: fmt.Sprintf(format, args...), Remediation: r.Remediation}
+			if rrtype != 0 {
+				f.Type = dns.TypeToString[rrtype]
+			}
+			out = append(out, f)
+		})
+	}
+	return out
+}
+
+// printLintFindings prints findings, with the remediation hint once per
+// rule.
+func printLintFindings(findings []lintFinding) {
+	hinted := map[string]bool{}
+	for _, f := range findings {
+		fmt.Printf("[!] %s\n", f)
+		if !hinted[f.ID] && f.Remediation != "" {
+			fmt.Printf("    -> %s\n", f.Remediation)
+			hinted[f.ID] = true
+		}
+	}
+}
+
+func looksLikeIP(name string) bool {
+	labels := dns.SplitDomainName(name)
+	if len(labels) != 4 {
+		return false
+	}
+	for _, l := range labels {
+		for _, c := range l {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lintTXT runs the mail policy syntax checks on the TXT records of a name.
+func lintTXT(report lintReporter, name string, txts []dns.RR) {
+	var spf, dmarc int
+	for _, rr := range txts {
+		v := strings.Join(rr.(*dns.TXT).Txt, "")
+		lower := strings.ToLower(v)
+		var findings []string
+		switch {
+		case strings.HasPrefix(lower, "v=spf1"):
+			spf++
+			findings = checkSPF(v)
+		case strings.HasPrefix(name, "_dmarc.") && strings.HasPrefix(lower, "v=dmarc1"):
+			dmarc++
+			findings = checkDMARC(v)
+		case strings.Contains(name, "._domainkey."):
+			findings = checkDKIM(v)
+		}
+		for _, f := range findings {
+			report(name, dns.TypeTXT, "%s", f)
+		}
+	}
+	if spf > 1 {
+		report(name, dns.TypeTXT, "%d SPF records; er mag er maar één zijn (RFC 7208 3.2)", spf)
+	}
+	if dmarc > 1 {
+		report(name, dns.TypeTXT, "%d DMARC records; er mag er maar één zijn", dmarc)
+	}
+}
+
+// ttlOutliers flags TTLs far from the zone's median, and values that are
+// low or high in absolute terms.
+func ttlOutliers(z *lintZoneData, report lintReporter) {
+	var ttls []uint32
+	for _, types := range z.ByName {
+		for _, set := range types {
+			for _, rr := range set {
+				ttls = append(ttls, rr.Header().Ttl)
+			}
+		}
+	}
+	if len(ttls) == 0 {
+		return
+	}
+	sort.Slice(ttls, func(i, j int) bool { return ttls[i] < ttls[j] })
+	median := ttls[len(ttls)/2]
+
+	for _, name := range sortedNames(z.ByName) {
+		for _, t := range sortedTypes(z.ByName[name]) {
+			ttl := z.ByName[name][t][0].Header().Ttl
+			switch {
+			case ttl < 60:
+				report(name, t, "TTL %d is erg laag (< 60s)", ttl)
+			case ttl > 604800:
+				report(name, t, "TTL %d is erg hoog (> 1 week)", ttl)
+			case median > 0 && (ttl*10 < median || ttl > median*10):
+				report(name, t, "TTL %d wijkt sterk af van de mediaan van de zone (%d)", ttl, median)
+			}
+		}
+	}
+}
+
+// longTXTStrings scans zone file source for quoted strings over 255 bytes.
+// An escape (\" or \DDD) counts as one byte. The owner is tracked the way
+// the parser does it: a line starting with whitespace keeps the previous
+// owner, and relative names are completed with $ORIGIN.
+func longTXTStrings(r io.Reader, origin string) []longString {
+	var out []longString
+	origin = dns.Fqdn(strings.ToLower(origin))
+	owner := origin
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if fields := strings.Fields(text); len(fields) > 0 && text[0] != ' ' && text[0] != '\t' && text[0] != ';' && text[0] != '"' {
+			switch name := strings.ToLower(fields[0]); {
+			case name == "$origin" && len(fields) > 1:
+				origin = dns.Fqdn(strings.ToLower(fields[1]))
+			case strings.HasPrefix(name, "$"):
+			case name == "@":
+				owner = origin
+			case dns.IsFqdn(name):
+				owner = name
+			default:
+				owner = name + "." + origin
+			}
+		}
+
+		in, n := false, 0
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case !in && c == ';':
+				i = len(text)
+			case c == '"':
+				if in && n > 255 {
+					out = append(out, longString{Owner: owner, Line: line, Len: n})
+				}
+				in, n = !in, 0
+			case in && c == '\\':
+				if i+3 < len(text) && isDigit(text[i+1]) && isDigit(text[i+2]) && isDigit(text[i+3]) {
+					i += 3
+				} else {
+					i++
+				}
+				n++
+			case in:
+				n++
+			}
+		}
+	}
+	return out
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func sortedNames(m map[string]map[uint16][]dns.RR) []string {
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool { return zoneNameLess(names[i], names[j]) })
+	return names
+}
+
+func sortedTypes(m map[uint16][]dns.RR) []uint16 {
+	types := make([]uint16, 0, len(m))
+	for t := range m {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func rrData(rr dns.RR) string {
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// zoneOrigin guesses the origin for a zone file from its name
+// ("example.com.zone", "db.example.com"); files with $ORIGIN don't need it.
+func zoneOrigin(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, ".zone")
+	base = strings.TrimSuffix(base, ".db")
+	base = strings.TrimPrefix(base, "db.")
+	if strings.Contains(base, ".") {
+		return dns.Fqdn(base)
+	}
+	return "."
+}
+
+// loadZoneFile parses a zone file and returns its records and apex (the
+// SOA owner, or the origin when there is no SOA).
+func loadZoneFile(path, origin string) ([]dns.RR, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	if origin == "" {
+		origin = zoneOrigin(path)
+	}
+	rrs, err := parseZone(f, origin, path)
+	if err != nil {
+		return nil, "", err
+	}
+	apex := dns.Fqdn(origin)
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			apex = rr.Header().Name
+			break
+		}
+	}
+	return rrs, strings.ToLower(apex), nil
+}
+
+// lintLive lints the records found for a report. Targets outside the zone
+// are looked up, so target-cname, target-missing and ns-missing-aaaa also
+// cover hosts at other providers.
+func lintLive(ctx context.Context, client *dns.Client, resolver string, r *dnsReport, rules []lintRule) []lintFinding {
+	var rrs []dns.RR
+	for _, rec := range collectZoneRecords(ctx, client, resolver, r) {
+		if rr, err := rec.RR(); err == nil {
+			rrs = append(rrs, rr)
+		}
+	}
+	z := newLintZoneData(r.Domain, rrs)
+	z.Hosts = map[string]lintHost{}
+	z.targets(func(_ string, _ uint16, target string) {
+		if _, done := z.Hosts[target]; done || target == "." || looksLikeIP(target) || dns.IsSubDomain(z.Apex, target) {
+			return
+		}
+		var h lintHost
+		if in, err := queryRecursive(ctx, client, resolver, target, dns.TypeCNAME); err == nil {
+			for _, rr := range in.Answer {
+				if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, target) {
+					h.CNAME = c.Target
+				}
+			}
+		}
+		v4, v6 := resolveHost(ctx, client, resolver, target)
+		h.V4, h.V6 = len(v4) > 0, len(v6) > 0
+		z.Hosts[target] = h
+	})
+	return runLintRules(z, rules)
+}
+
+// runLintCmd implements "ultradns lint". Exit codes: 0 clean, 1 an error
+// finding (with -strict also a warning), 2 the file could not be read or
+// parsed. Info findings never fail the run, as with -lint.
+func runLintCmd(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	var origin string
+	var asJSON, listRules, strict bool
+	var sel lintSelection
+	fs.StringVar(&origin, "origin", "", "Zone origin als het bestand geen $ORIGIN heeft (default: afgeleid van de bestandsnaam)")
+	fs.Var((*stringList)(&sel.Only), "rules", "Alleen deze regels draaien (IDs, komma-gescheiden)")
+	fs.Var((*stringList)(&sel.Skip), "skip", "Deze regels overslaan (IDs, komma-gescheiden)")
+	fs.StringVar(&sel.MinSeverity, "min-severity", sevInfo, "Laagste severity die gemeld wordt: info, warning of error")
+	fs.BoolVar(&listRules, "list-rules", false, "Toon alle regels met hun ID en severity")
+	fs.BoolVar(&asJSON, "json", false, "Output als JSON")
+	fs.BoolVar(&strict, "strict", false, "Exit code 1 ook bij warnings, niet alleen bij errors")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns lint [-origin example.com] [-rules id,...] [-skip id,...] <zone.db> [...]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns lint -list-rules\n\n")
+		fmt.Fprintf(os.Stderr, "Controleert BIND zone files offline: CNAME op de apex of naast andere data, MX/NS naar een IP of CNAME,\n")
+		fmt.Fprintf(os.Stderr, "ontbrekende glue, SOA timers, TXT strings over 255 bytes, SPF/DMARC/DKIM syntax, TTL's en dubbele records.\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = geen errors, 1 = error bevindingen (met -strict ook warnings), 2 = fout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if listRules {
+		for _, r := range lintRules {
+			fmt.Printf("%-22s %-8s %s\n", r.ID, r.Severity, r.Description)
+		}
+		return exitOK
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	rules, err := sel.rules()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	results := map[string][]lintFinding{}
+	var st runStatus
+	for _, path := range fs.Args() {
+		rrs, apex, err := loadZoneFile(path, origin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+		z := newLintZoneData(apex, rrs)
+		if f, err := os.Open(path); err == nil {
+			z.LongStrings = longTXTStrings(f, apex)
+			f.Close()
+		}
+		findings := runLintRules(z, rules)
+		results[path] = findings
+		st.lint(findings)
+
+		if asJSON {
+			continue
+		}
+		printHeader(fmt.Sprintf("LINT %s (%s, %d records)", path, apex, len(rrs)))
+		if len(findings) == 0 {
+			fmt.Println("Geen bevindingen")
+		}
+		printLintFindings(findings)
+		fmt.Println()
+	}
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, results); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	}
+	return st.exitCode(strict)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Syntax checks for the mail policy records. They work on the joined TXT
+// string, so the live mode and the offline zone linter share them.
+
+// spfLookupTerms count towards the RFC 7208 limit of 10 DNS lookups.
+var spfLookupTerms = map[string]bool{"include": true, "a": true, "mx": true, "ptr": true, "exists": true, "redirect": true}
+
+// checkSPF validates an SPF record (RFC 7208). Only the lookups of the
+// record itself are counted; includes are not followed.
+func checkSPF(v string) []string {
+	var out []string
+	terms := strings.Fields(v)
+	if len(terms) == 0 || !strings.EqualFold(terms[0], "v=spf1") {
+		return []string{"SPF moet beginnen met v=spf1"}
+	}
+
+	lookups := 0
+	seenAll := false
+	modifiers := map[string]bool{}
+	for _, term := range terms[1:] {
+		if seenAll {
+			out = append(out, fmt.Sprintf("SPF: %q na 'all' wordt genegeerd", term))
+			continue
+		}
+		if name, _, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+			name = strings.ToLower(name)
+			if name != "redirect" && name != "exp" {
+				out = append(out, fmt.Sprintf("SPF: onbekende modifier %q", term))
+				continue
+			}
+			if modifiers[name] {
+				out = append(out, fmt.Sprintf("SPF: modifier %s komt meerdere keren voor", name))
+			}
+			modifiers[name] = true
+			if spfLookupTerms[name] {
+				lookups++
+			}
+			continue
+		}
+
+		mech := strings.ToLower(strings.TrimLeft(term, "+-~?"))
+		if len(term)-len(mech) > 1 {
+			out = append(out, fmt.Sprintf("SPF: meerdere qualifiers in %q", term))
+		}
+		name, arg, hasArg := strings.Cut(mech, ":")
+		if !hasArg {
+			name, arg, _ = strings.Cut(mech, "/")
+			if arg != "" {
+				arg = "/" + arg
+			}
+		}
+		switch name {
+		case "all":
+			seenAll = true
+			if strings.HasPrefix(term, "+") || term == "all" {
+				out = append(out, "SPF: '+all' staat elke afzender toe")
+			}
+		case "include", "exists":
+			if !hasArg || arg == "" {
+				out = append(out, fmt.Sprintf("SPF: %s vereist een domein", name))
+			}
+			lookups++
+		case "a", "mx":
+			lookups++
+		case "ptr":
+			lookups++
+			out = append(out, "SPF: ptr is afgeraden (RFC 7208 5.5)")
+		case "ip4", "ip6":
+			if !hasArg {
+				out = append(out, fmt.Sprintf("SPF: %s vereist een adres", name))
+				break
+			}
+			addr := arg
+			if !strings.Contains(addr, "/") {
+				if name == "ip4" {
+					addr += "/32"
+				} else {
+					addr += "/128"
+				}
+			}
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil || (name == "ip4") != (ip.To4() != nil) {
+				out = append(out, fmt.Sprintf("SPF: ongeldig %s adres %q", name, arg))
+			}
+		default:
+			out = append(out, fmt.Sprintf("SPF: onbekend mechanisme %q", term))
+		}
+	}
+	if modifiers["redirect"] && seenAll {
+		out = append(out, "SPF: redirect wordt genegeerd omdat er een 'all' is")
+	}
+	if lookups > 10 {
+		out = append(out, fmt.Sprintf("SPF: %d DNS lookups in dit record (maximaal 10)", lookups))
+	}
+	return out
+}
+
+// dmarcTags splits a tag list ("v=DMARC1; p=reject") into ordered pairs.
+func dmarcTags(v string) (keys []string, tags map[string]string) {
+	tags = map[string]string{}
+	for _, part := range strings.Split(v, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, val, _ := strings.Cut(part, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		keys = append(keys, k)
+		tags[k] = strings.TrimSpace(val)
+	}
+	return keys, tags
+}
+
+// checkDMARC validates a DMARC record (RFC 7489 6.3).
+func checkDMARC(v string) []string {
+	keys, tags := dmarcTags(v)
+	if len(keys) == 0 || keys[0] != "v" || tags["v"] != "DMARC1" {
+		return []string{"DMARC moet beginnen met v=DMARC1"}
+	}
+	var out []string
+	if len(keys) < 2 || keys[1] != "p" {
+		out = append(out, "DMARC: p= moet direct na v=DMARC1 komen")
+	}
+	policies := map[string]bool{"none": true, "quarantine": true, "reject": true}
+	if p, ok := tags["p"]; !ok {
+		out = append(out, "DMARC: p= ontbreekt")
+	} else if !policies[strings.ToLower(p)] {
+		out = append(out, fmt.Sprintf("DMARC: ongeldige policy p=%s", p))
+	}
+	if sp, ok := tags["sp"]; ok && !policies[strings.ToLower(sp)] {
+		out = append(out, fmt.Sprintf("DMARC: ongeldige policy sp=%s", sp))
+	}
+	for _, k := range []string{"adkim", "aspf"} {
+		if val, ok := tags[k]; ok && val != "r" && val != "s" {
+			out = append(out, fmt.Sprintf("DMARC: %s moet r of s zijn, niet %q", k, val))
+		}
+	}
+	if pct, ok := tags["pct"]; ok {
+		if n, err := strconv.Atoi(pct); err != nil || n < 0 || n > 100 {
+			out = append(out, fmt.Sprintf("DMARC: pct moet 0-100 zijn, niet %q", pct))
+		}
+	}
+	for _, k := range []string{"rua", "ruf"} {
+		val, ok := tags[k]
+		if !ok {
+			continue
+		}
+		for _, uri := range strings.Split(val, ",") {
+			uri = strings.TrimSpace(uri)
+			if !strings.HasPrefix(strings.ToLower(uri), "mailto:") || !strings.Contains(uri, "@") {
+				out = append(out, fmt.Sprintf("DMARC: %s %q is geen mailto: adres", k, uri))
+			}
+		}
+	}
+	known := map[string]bool{"v": true, "p": true, "sp": true, "adkim": true, "aspf": true, "pct": true, "rua": true, "ruf": true, "fo": true, "rf": true, "ri": true, "np": true, "t": true, "psd": true}
+	for _, k := range keys {
+		if !known[k] {
+			out = append(out, fmt.Sprintf("DMARC: onbekende tag %q", k))
+		}
+	}
+	return out
+}
+
+// mailFindings runs the syntax checks on the policy records in m.
+func mailFindings(m mailReport) []string {
+	var out []string
+	if m.SPF != "" {
+		out = append(out, checkSPF(m.SPF)...)
+	}
+	if m.DMARC != "" {
+		out = append(out, checkDMARC(m.DMARC)...)
+	}
+	for _, k := range m.DKIM {
+		out = append(out, checkDKIM(k.Record)...)
+	}
+	return out
+}
+
+// checkDKIM validates a DKIM key record (RFC 6376 3.6.1).
+func checkDKIM(v string) []string {
+	keys, tags := dmarcTags(v)
+	var out []string
+	if ver, ok := tags["v"]; ok && (keys[0] != "v" || ver != "DKIM1") {
+		out = append(out, "DKIM: v= moet de eerste tag zijn en DKIM1 zijn")
+	}
+	if k, ok := tags["k"]; ok && k != "rsa" && k != "ed25519" {
+		out = append(out, fmt.Sprintf("DKIM: onbekend sleuteltype k=%s", k))
+	}
+	p, ok := tags["p"]
+	switch {
+	case !ok:
+		out = append(out, "DKIM: p= (publieke sleutel) ontbreekt")
+	case p == "":
+		out = append(out, "DKIM: lege p=, de sleutel is ingetrokken")
+	default:
+		key, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p), ""))
+		if err != nil {
+			out = append(out, "DKIM: p= is geen geldige base64")
+		} else if tags["k"] != "ed25519" && len(key) < 140 {
+			// A 1024-bit RSA SubjectPublicKeyInfo is 162 bytes.
+			out = append(out, fmt.Sprintf("DKIM: RSA sleutel van %d bytes is korter dan 1024 bits", len(key)))
+		}
+	}
+	if t, ok := tags["t"]; ok {
+		for _, f := range strings.Split(t, ":") {
+			if f = strings.TrimSpace(f); f != "y" && f != "s" {
+				out = append(out, fmt.Sprintf("DKIM: onbekende flag t=%s", f))
+			}
+		}
+		if strings.Contains(t, "y") {
+			out = append(out, "DKIM: t=y, het domein staat in testmodus")
+		}
+	}
+	return out
+}
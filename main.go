@@ -2,21 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net"
-	"net/http"
 	"os"
 	"runtime"
 	"sort"
 	"strings"
 	"time"
 
-	whois "github.com/likexian/whois"
-	whoisparser "github.com/likexian/whois-parser"
 	"github.com/miekg/dns"
 )
 
@@ -47,23 +42,131 @@ type options struct {
 	caa   bool
 	srv   bool
 
+	caaCA       string
+	caaWildcard bool
+
+	srvFile   string
+	srvLabels stringList
+
+	warnDays int
+
+	asn   bool
+	asnDB string
+
+	diversity  bool
+	delegation bool
+
+	json   bool
+	strict bool
+
+	takeover     bool
+	takeoverDB   string
+	takeoverZone string
+
+	subsResolve bool
+	subsHTTP    bool
+	subsWorkers int
+	subsSources stringList
+	subsConfig  string
+	subsImport  stringList
+	sources     []subdomainSource // built from the three above
+
+	certs        bool
+	certWarnDays int
+
+	brute        bool
+	wordlist     string
+	bruteWorkers int
+	bruteDepth   int
+
+	file    string
+	workers int
+	rate    float64
+	format  string
+	failed  string
+
+	zoneOut string
+
+	lint      bool
+	lintRules stringList
+	lintSkip  stringList
+
+	watch      time.Duration
+	watchState string
+	watchLog   string
+	webhook    string
+
+	whoisRaw    bool
+	whoisServer string
+	whoisFollow bool
+
+	noRDAP        bool
+	rdapServer    string
+	rdapBootstrap string
+
 	resolver string
 	timeout  time.Duration
 }
 
+// subcommands are dispatched on the first argument, before the regular flags are parsed.
+var subcommands = map[string]func(args []string) int{
+	"tlsrpt":      runTLSRPTCmd,
+	"snapshot":    runSnapshotCmd,
+	"diff":        runDiffCmd,
+	"lint":        runLintCmd,
+	"drift":       runDriftCmd,
+	"migrate":     runMigrateCmd,
+	"propagation": runPropagationCmd,
+	"check":       runCheckCmd,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	var o options
 
 	flag.BoolVar(&o.help, "help", false, "Toon help")
 	flag.BoolVar(&o.help, "h", false, "Toon help (kort)")
 	flag.BoolVar(&o.version, "version", false, "Toon versie")
 
-	flag.StringVar(&o.domain, "d", "", "Domein (bijv. lucasmangroelal.nl)")
+	flag.StringVar(&o.domain, "d", "", "Domein (bijv. lucasmangroelal.nl), of - om domeinen van stdin te lezen")
+	flag.StringVar(&o.file, "f", "", "Bestand met domeinen (één per regel) voor batch mode")
+	flag.IntVar(&o.workers, "workers", 4, "Batch mode: aantal domeinen tegelijk")
+	flag.Float64Var(&o.rate, "rate", 0, "Maximaal aantal DNS queries per seconde (totaal, 0 = onbeperkt; voor batch mode en -brute)")
+	flag.StringVar(&o.format, "format", "jsonl", "Batch mode: output formaat (jsonl of csv)")
+	flag.StringVar(&o.zoneOut, "zone-out", "", "Exporteer de gevonden records als BIND zone file naar dit bestand (impliceert -n)")
+	flag.BoolVar(&o.lint, "lint", false, "Controleer de live records met de lint regels (CNAME op apex, MX/NS naar IP/CNAME, SOA timers, ...; impliceert -n)")
+	flag.Var(&o.lintRules, "lint-rules", "Lint: alleen deze regels (IDs, zie ultradns lint -list-rules)")
+	flag.Var(&o.lintSkip, "lint-skip", "Lint: deze regels overslaan")
+	flag.DurationVar(&o.watch, "watch", 0, "Blijf het domein elk interval bevragen en meld wijzigingen (bijv. 5m)")
+	flag.StringVar(&o.watchState, "watch-state", "", "Watch: bewaar de laatste staat in dit bestand (overleeft herstarts)")
+	flag.StringVar(&o.watchLog, "watch-log", "", "Watch: schrijf wijzigingen als JSON regels naar dit bestand")
+	flag.StringVar(&o.webhook, "webhook", "", "Watch: POST wijzigingen als JSON naar deze URL")
+	flag.StringVar(&o.failed, "failed-out", "", "Batch mode: schrijf mislukte domeinen naar dit bestand (te hervatten met -f)")
 
 	flag.BoolVar(&o.inf, "inf", false, "Alle info (DNS + mail checks; combineer met -n of -whois voor specifiek)")
 	flag.BoolVar(&o.n, "n", false, "Alle DNS records info (A/AAAA/CNAME/MX/NS/TXT/SOA/CAA/SRV) + mail checks (werkt goed met -inf)")
-	flag.BoolVar(&o.whois, "whois", false, "WHOIS info (registratie/expiratie/nameservers waar mogelijk)")
+	flag.BoolVar(&o.whois, "whois", false, "WHOIS/RDAP info (registratie/expiratie/nameservers waar mogelijk; -d mag ook een IP of ASN zijn)")
 	flag.BoolVar(&o.subs, "subs", false, "Subdomeinen verzamelen (certificate transparency)")
+	flag.Var(&o.subsSources, "subs-sources", "Subdomein bronnen: crtsh, certspotter (API key via CERTSPOTTER_API_KEY; impliceert -subs). Default: crtsh")
+	flag.StringVar(&o.subsConfig, "subs-config", "", "Subdomein bronnen uit YAML: type, name, url, api_key(_env), rate per bron (impliceert -subs)")
+	flag.Var(&o.subsImport, "subs-import", "Subdomeinen uit een eerder gedownloade JSON dump lezen (crt.sh, Cert Spotter, lijst of -json output; impliceert -subs)")
+	flag.BoolVar(&o.certs, "certs", false, "Certificaten uit CT: per subdomein, uitgevers, bijna verlopen en CA's die CAA niet toestaat (impliceert -subs)")
+	flag.IntVar(&o.certWarnDays, "cert-warn-days", 14, "Certs: waarschuw als het nieuwste certificaat van een naam binnen zoveel dagen verloopt")
+	flag.BoolVar(&o.subsResolve, "subs-resolve", false, "Subdomeinen uit CT resolven en indelen: live, NXDOMAIN, CNAME naar extern (impliceert -subs)")
+	flag.BoolVar(&o.subsHTTP, "subs-http", false, "Live subdomeinen ook via HTTP/HTTPS bevragen: status en paginatitel (impliceert -subs-resolve)")
+	flag.IntVar(&o.subsWorkers, "subs-workers", 10, "Aantal namen tegelijk resolven (-subs-resolve, -takeover)")
+	flag.BoolVar(&o.takeover, "takeover", false, "Dangling CNAMEs en subdomain takeover zoeken in de zone, CT (-subs) en woordenlijst (-brute) namen (impliceert -n)")
+	flag.StringVar(&o.takeoverDB, "takeover-db", "", "Takeover: fingerprint database (JSON, formaat van can-i-take-over-xyz; impliceert -takeover)")
+	flag.StringVar(&o.takeoverZone, "takeover-zone", "", "Takeover: ook de namen uit deze zone file controleren (impliceert -takeover)")
+	flag.BoolVar(&o.brute, "brute", false, "Subdomeinen brute-forcen met een woordenlijst via de resolver (met wildcard detectie)")
+	flag.StringVar(&o.wordlist, "w", "", "Woordenlijst voor -brute (één label per regel; impliceert -brute). Default: ingebouwde lijst")
+	flag.IntVar(&o.bruteWorkers, "brute-workers", 10, "Brute: aantal queries tegelijk")
+	flag.IntVar(&o.bruteDepth, "brute-depth", 1, "Brute: zoek ook onder gevonden subdomeinen, tot zoveel niveaus diep")
 
 	flag.BoolVar(&o.a, "a", false, "Alleen A records (IPv4)")
 	flag.BoolVar(&o.aaaa, "aaaa", false, "Alleen AAAA records (IPv6)")
@@ -75,6 +178,27 @@ func main() {
 	flag.BoolVar(&o.caa, "caa", false, "Alleen CAA")
 	flag.BoolVar(&o.srv, "srv", false, "Alleen SRV")
 
+	flag.BoolVar(&o.asn, "asn", false, "Verrijk A/AAAA en MX IP's met ASN, prefix, AS naam en land (Team Cymru via de resolver)")
+	flag.StringVar(&o.asnDB, "asn-db", "", "Offline MaxMind/IPinfo .mmdb bestand voor IP verrijking (impliceert -asn)")
+	flag.BoolVar(&o.diversity, "diversity", false, "Analyseer NS/MX spreiding: IPv4/IPv6, subnetten, ASN's en glue (single points of failure)")
+	flag.BoolVar(&o.delegation, "delegation", false, "Vergelijk NS en glue bij de parent (TLD) met de NS set van de eigen nameservers (lame delegaties, glue, mismatches)")
+	flag.BoolVar(&o.strict, "strict", false, "Exit code 1 bij elke waarschuwing ([!] bevindingen), niet alleen bij fouten")
+	flag.BoolVar(&o.json, "json", false, "Output als JSON (DNS records, mail checks, WHOIS, subdomeinen)")
+
+	flag.IntVar(&o.warnDays, "warn-days", 0, "Exit code 1 als het domein binnen N dagen verloopt of op hold/redemption staat (impliceert -whois)")
+	flag.BoolVar(&o.whoisRaw, "whois-raw", false, "Toon de ruwe WHOIS output van elke server in de keten (gebruikt WHOIS i.p.v. RDAP)")
+	flag.StringVar(&o.whoisServer, "whois-server", "", "Vraag deze WHOIS server (host[:port]) i.p.v. de IANA keten (gebruikt WHOIS i.p.v. RDAP)")
+	flag.BoolVar(&o.whoisFollow, "whois-follow", true, "Volg registry -> registrar referrals")
+	flag.BoolVar(&o.noRDAP, "no-rdap", false, "Sla RDAP over en gebruik alleen WHOIS (poort 43)")
+	flag.StringVar(&o.rdapServer, "rdap-server", "", "Vaste RDAP base URL (slaat IANA bootstrap over), bijv. http://127.0.0.1:8080/")
+	flag.StringVar(&o.rdapBootstrap, "rdap-bootstrap", defaultRDAPBootstrap, "Base URL van de IANA RDAP bootstrap bestanden")
+
+	flag.StringVar(&o.srvFile, "srv-file", "", "Bestand met SRV labels (vervangt de ingebouwde lijst; één label per regel)")
+	flag.Var(&o.srvLabels, "srv-label", "Extra SRV label(s), bijv. _minecraft._tcp (komma-gescheiden of herhaalbaar)")
+
+	flag.StringVar(&o.caaCA, "caa-ca", "", "Check of deze CA (issuer domein, bijv. letsencrypt.org) mag uitgeven volgens CAA (impliceert -caa)")
+	flag.BoolVar(&o.caaWildcard, "caa-wildcard", false, "Evalueer -caa-ca voor een wildcard certificaat (*.domein)")
+
 	flag.StringVar(&o.resolver, "r", "", "Resolver (ip:port). Default: systeem resolvers of 8.8.8.8:53")
 	flag.DurationVar(&o.timeout, "timeout", 5*time.Second, "Timeout per query")
 
@@ -82,12 +206,30 @@ func main() {
 		printBanner()
 		fmt.Fprintf(os.Stderr, "Version: %s\n\n", version)
 		fmt.Fprintf(os.Stderr, "Gebruik:\n")
-		fmt.Fprintf(os.Stderr, "  ultradns -d <domein> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d <domein> [flags]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -f <domeinen.txt> [-workers N] [-rate Q] [-format jsonl|csv] [flags]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d <domein> -watch 5m [-watch-state staat.json] [-watch-log log.jsonl] [-webhook URL]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns snapshot -d <domein> -out <snapshot.json>\n")
+		fmt.Fprintf(os.Stderr, "  ultradns diff <oud.json> <nieuw.json>\n")
+		fmt.Fprintf(os.Stderr, "  ultradns lint <zone.db> [...]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns drift <zone.db> [-server ns] [-via resolver]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns migrate -d <domein> -new <ns1,ns2> [-old <ns1,ns2>] [-zone zone.db]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns propagation -d <naam> [-t A] [-resolvers 1.1.1.1,8.8.8.8]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns check -spec dns.yaml [-junit resultaten.xml]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns tlsrpt <rapport.json[.gz]> [...]\n\n")
 		fmt.Fprintf(os.Stderr, "Voorbeelden:\n")
 		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -subs\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -subs-sources crtsh,certspotter -subs-import oud.json\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -certs -cert-warn-days 21\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -subs-http -subs-workers 20\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -takeover -subs -brute\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -brute -w woorden.txt -brute-depth 2 -rate 50\n")
 		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -inf -n\n")
 		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -whois\n")
-		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -whois\n\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -whois\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -n -asn -json\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -lint -lint-skip ttl-outlier\n")
+		fmt.Fprintf(os.Stderr, "  ultradns -d lucasmangroelal.nl -caa-ca letsencrypt.org -caa-wildcard\n\n")
 		fmt.Fprintf(os.Stderr, "Voor aanvals tools (voorheen -aanval), zie: sitestress --help\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
 		flag.PrintDefaults()
@@ -99,26 +241,79 @@ func main() {
 		printBanner()
 		fmt.Printf("Version: %s\n", version)
 		fmt.Printf("Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
-		os.Exit(0)
+		os.Exit(exitOK)
 	}
 	if o.help {
 		flag.Usage()
-		os.Exit(0)
+		os.Exit(exitOK)
 	}
 
-	if o.domain == "" {
+	if o.domain == "" && o.file == "" {
 		flag.Usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
 	}
 
-	domain := normalizeDomain(o.domain)
+	if o.caaCA != "" {
+		o.caa = true
+	}
+	if o.warnDays > 0 || o.whoisRaw || o.whoisServer != "" {
+		o.whois = true
+	}
+
+	if o.wordlist != "" {
+		o.brute = true
+	}
+	if o.takeoverDB != "" || o.takeoverZone != "" {
+		o.takeover = true
+	}
+	if o.subsHTTP {
+		o.subsResolve = true
+	}
+	if o.subsResolve || o.certs || len(o.subsSources) > 0 || o.subsConfig != "" || len(o.subsImport) > 0 {
+		o.subs = true
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	srvCatalogue, err := loadSRVCatalogue(o.srvFile, o.srvLabels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if o.subs {
+		if o.sources, err = subdomainSources(o); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if o.brute {
+		if _, err := bruteWords(o); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	if o.rate > 0 {
+		// A huge rate rounds down to a zero interval, which NewTicker rejects.
+		interval := max(time.Duration(float64(time.Second)/o.rate), time.Nanosecond)
+		queryLimiter = time.NewTicker(interval)
+		defer queryLimiter.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout(o))
 	defer cancel()
 
 	resolver := pickResolver(o.resolver)
 	client := &dns.Client{Timeout: o.timeout}
 
+	// The diversity analysis needs origin ASNs, so it turns on enrichment.
+	if o.diversity {
+		o.asn = true
+	}
+	enricher, err := newIPEnricher(o, client, resolver)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
 	// Default behavior: if user only passes -d without record flags, show -inf -n equivalent.
 	if !anyQueryFlagSet(o) {
 		o.inf = true
@@ -126,7 +321,7 @@ func main() {
 	}
 
 	// If -inf is set but neither -n nor -whois were specified, show both.
-	if o.inf && !o.n && !o.whois && !anyRecordOnlyFlagSet(o) && !o.subs {
+	if o.inf && !o.n && !o.whois && !anyRecordOnlyFlagSet(o) && !o.subs && !o.brute && !o.diversity && !o.delegation {
 		o.n = true
 		o.whois = true
 	}
@@ -137,99 +332,310 @@ func main() {
 		o.inf = false
 	}
 
+	// A zone export, the linter and the takeover check need the full record
+	// collection.
+	if o.zoneOut != "" || o.lint || o.takeover {
+		o.n = true
+	}
+	// A batch has no single zone to export, and with -zone-out - the zone
+	// file is stdout, which only the -json report can move away from.
+	if o.zoneOut != "" && (o.file != "" || o.domain == "-") {
+		fmt.Fprintf(os.Stderr, "error: -zone-out werkt niet in batch modus (-f of -d -)\n")
+		os.Exit(exitUsage)
+	}
+	if o.zoneOut == "-" && !o.json {
+		fmt.Fprintf(os.Stderr, "error: -zone-out - vereist -json (het rapport gaat dan naar stderr)\n")
+		os.Exit(exitUsage)
+	}
+	if _, err := o.lintSelection().rules(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if o.takeover {
+		if _, _, err := takeoverInputs(o, normalizeDomain(o.domain)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	if o.file != "" || o.domain == "-" {
+		cancel()
+		os.Exit(runBatch(client, resolver, o, srvCatalogue, enricher))
+	}
+
+	domain := normalizeDomain(o.domain)
+
+	if o.watch > 0 {
+		cancel()
+		os.Exit(runWatch(client, resolver, domain, o, srvCatalogue))
+	}
+
+	if o.json {
+		var out io.Writer = os.Stdout
+		if o.zoneOut == "-" {
+			out = os.Stderr
+		}
+		os.Exit(runJSON(ctx, client, resolver, domain, o, srvCatalogue, enricher, out, os.Stdout))
+	}
+
+	var st runStatus
+
 	printBanner()
 	fmt.Printf("Version: %s | Platform: %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
 	fmt.Printf("Domain: %s | Resolver: %s\n\n", domain, resolver)
 
+	var subs []string
+	var certs []ctCert
+	ctOK := false
 	if o.subs {
 		printHeader("SUBDOMEINEN")
-		subs, err := fetchSubdomainsCT(ctx, domain)
+		res, err := fetchSubdomains(ctx, domain, o.sources)
+		if len(o.sources) > 1 {
+			printSubdomainSources(res, o.sources)
+		}
 		if err != nil {
 			fmt.Printf("error: %v\n\n", err)
-		} else if len(subs) == 0 {
-			fmt.Printf("geen subdomeinen gevonden via CT\n\n")
+			st.fail(exitCT)
 		} else {
-			for _, s := range subs {
-				fmt.Println(s)
+			subs, certs, ctOK = res.Names, res.Certs, true
+			st.warn(len(res.Errors))
+			switch {
+			case len(subs) == 0:
+				fmt.Printf("geen subdomeinen gevonden\n\n")
+			case o.subsResolve:
+				infos := classifySubdomains(ctx, client, resolver, domain, subs, o.subsWorkers, o.subsHTTP)
+				fmt.Printf("%d subdomeinen", len(subs))
+				printSubdomainInventory(infos)
+				st.inventory(infos)
+				fmt.Println()
+			default:
+				for _, s := range subs {
+					if len(o.sources) > 1 {
+						fmt.Printf("%s [%s]\n", s, strings.Join(res.Sources[s], ", "))
+					} else {
+						fmt.Println(s)
+					}
+				}
+				fmt.Println()
 			}
-			fmt.Println()
 		}
 	}
 
+	if o.certs && ctOK {
+		printHeader("CERTIFICATEN (CT)")
+		rep := analyseCerts(ctx, client, resolver, certs, o.certWarnDays, time.Now())
+		printCerts(rep)
+		st.certs(rep)
+		fmt.Println()
+	}
+
+	var bruteRep *bruteReport
+	if o.brute {
+		printHeader("SUBDOMEINEN (WOORDENLIJST)")
+		words, _ := bruteWords(o)
+		bruteRep = bruteForce(ctx, client, resolver, domain, words, o.bruteWorkers, o.bruteDepth)
+		printBrute(bruteRep)
+		st.brute(bruteRep)
+		fmt.Println()
+	}
+
 	if o.whois {
 		printHeader("WHOIS")
-		if err := runWhois(domain); err != nil {
+		ok, err := runWhois(ctx, domain, o)
+		if err != nil {
 			fmt.Printf("error: %v\n\n", err)
+			st.fail(exitWHOIS)
 		} else {
+			if !ok {
+				st.fail(exitFindings)
+			}
 			fmt.Println()
 		}
 	}
 
+	var report *dnsReport
 	if o.n {
 		printHeader("DNS INFO (ALLE RECORDS) + MAIL CHECKS")
-		if err := runAllDNS(ctx, client, resolver, domain); err != nil {
+		report = collectDNS(ctx, client, resolver, domain, srvCatalogue, enricher)
+		if err := runAllDNS(ctx, client, report); err != nil {
 			fmt.Printf("error: %v\n\n", err)
 		} else {
 			fmt.Println()
 		}
+		st.report(report)
+	}
+
+	if o.diversity {
+		printHeader("NS/MX DIVERSITEIT")
+		if report == nil {
+			report = collectInfra(ctx, client, resolver, domain)
+		}
+		div := analyseDiversity(ctx, client, resolver, report, enricher)
+		printDiversity(div)
+		st.warn(len(div.Findings))
+		fmt.Println()
+	}
+
+	if o.delegation {
+		printHeader("DELEGATIE (PARENT/CHILD)")
+		rep, err := checkDelegation(ctx, client, resolver, domain)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			st.failErr(err)
+		} else {
+			printDelegation(rep)
+			st.warn(len(rep.Findings))
+		}
+		fmt.Println()
 	}
 
 	// Record-only commands
-	if o.a {
-		printHeader("A")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeA))
+	recordOnly := func(title string, qtype uint16) {
+		printHeader(title)
+		q := runQuery(ctx, client, resolver, domain, qtype)
+		printQueryResult(q)
+		st.query(domain, q)
 		fmt.Println()
 	}
+	if o.a {
+		recordOnly("A", dns.TypeA)
+	}
 	if o.aaaa {
-		printHeader("AAAA")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeAAAA))
-		fmt.Println()
+		recordOnly("AAAA", dns.TypeAAAA)
 	}
 	if o.cname {
-		printHeader("CNAME")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeCNAME))
-		fmt.Println()
+		recordOnly("CNAME", dns.TypeCNAME)
 	}
 	if o.mx {
-		printHeader("MX")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeMX))
-		fmt.Println()
+		recordOnly("MX", dns.TypeMX)
 	}
 	if o.ns {
-		printHeader("NS")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeNS))
-		fmt.Println()
+		recordOnly("NS", dns.TypeNS)
 	}
 	if o.txt {
-		printHeader("TXT")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeTXT))
-		fmt.Println()
+		recordOnly("TXT", dns.TypeTXT)
 	}
 	if o.soa {
-		printHeader("SOA")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeSOA))
-		fmt.Println()
+		recordOnly("SOA", dns.TypeSOA)
 	}
 	if o.caa {
-		printHeader("CAA")
-		printRRs(queryType(ctx, client, resolver, domain, dns.TypeCAA))
+		recordOnly("CAA", dns.TypeCAA)
+		ok, err := runCAA(ctx, client, resolver, domain, o.caaCA, o.caaWildcard)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			st.failErr(err)
+		} else if !ok {
+			st.fail(exitFindings)
+		}
 		fmt.Println()
 	}
 	if o.srv {
 		printHeader("SRV")
-		if err := runCommonSRV(ctx, client, resolver, domain); err != nil {
+		l := runCommonSRV(ctx, client, resolver, domain, srvCatalogue)
+		if err := l.err(); err != nil {
+			st.failErr(err)
+		} else {
+			st.warn(len(l.Failed))
+		}
+		fmt.Println()
+	}
+
+	if o.lint && report != nil {
+		printHeader("LINT")
+		rules, _ := o.lintSelection().rules()
+		findings := lintLive(ctx, client, resolver, report, rules)
+		if len(findings) == 0 {
+			fmt.Println("Geen bevindingen")
+		}
+		printLintFindings(findings)
+		st.lint(findings)
+		fmt.Println()
+	}
+
+	if o.takeover && report != nil {
+		printHeader("TAKEOVER (DANGLING CNAMES)")
+		db, zoneRRs, _ := takeoverInputs(o, domain)
+		names := takeoverNames(collectZoneRecords(ctx, client, resolver, report), zoneRRs, subs, bruteRep)
+		rep := checkTakeover(ctx, client, resolver, names, db, o.subsWorkers)
+		printTakeover(rep)
+		st.takeover(rep)
+		fmt.Println()
+	}
+
+	if o.zoneOut != "" && report != nil {
+		printHeader("ZONE EXPORT")
+		n, err := exportZone(ctx, client, resolver, report, o.zoneOut, os.Stdout)
+		if err != nil {
 			fmt.Printf("error: %v\n", err)
+			st.fail(exitFindings)
+		} else {
+			fmt.Printf("%d records geschreven naar %s\n", n, o.zoneOut)
 		}
 		fmt.Println()
 	}
 
+	if code := st.exitCode(o.strict); code != exitOK {
+		cancel()
+		os.Exit(code)
+	}
+}
+
+func (o options) lintSelection() lintSelection {
+	return lintSelection{Only: o.lintRules, Skip: o.lintSkip}
+}
+
+// stringList is a flag.Value that accepts comma-separated and repeated values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
 }
 
 func anyQueryFlagSet(o options) bool {
-	return o.inf || o.n || o.whois || o.subs ||
+	return o.inf || o.n || o.whois || o.subs || o.brute || o.diversity || o.delegation ||
 		o.a || o.aaaa || o.cname || o.mx || o.ns || o.txt || o.soa || o.caa || o.srv
 }
 
+// recordOnlyTypes returns the query types selected with the record-only flags.
+func recordOnlyTypes(o options) []uint16 {
+	var out []uint16
+	for _, f := range []struct {
+		set   bool
+		qtype uint16
+	}{
+		{o.a, dns.TypeA}, {o.aaaa, dns.TypeAAAA}, {o.cname, dns.TypeCNAME}, {o.mx, dns.TypeMX},
+		{o.ns, dns.TypeNS}, {o.txt, dns.TypeTXT}, {o.soa, dns.TypeSOA}, {o.caa, dns.TypeCAA},
+	} {
+		if f.set {
+			out = append(out, f.qtype)
+		}
+	}
+	return out
+}
+
+// runTimeout is the time budget for one domain. A wordlist enumeration
+// sends thousands of queries, especially with -rate; resolving and probing
+// every CT name, following every CNAME chain for -takeover and the CAA
+// lookups of -certs take a while too.
+func runTimeout(o options) time.Duration {
+	switch {
+	case o.brute:
+		return 30 * time.Minute
+	case o.subsResolve, o.takeover, o.certs:
+		return 10 * time.Minute
+	}
+	return 60 * time.Second
+}
+
 func anyRecordOnlyFlagSet(o options) bool {
 	return o.a || o.aaaa || o.cname || o.mx || o.ns || o.txt || o.soa || o.caa || o.srv
 }
@@ -260,231 +666,208 @@ func pickResolver(flagVal string) string {
 	return "8.8.8.8:53"
 }
 
-func queryType(ctx context.Context, client *dns.Client, resolver, name string, qtype uint16) ([]dns.RR, error) {
-	m := new(dns.Msg)
-	m.SetQuestion(dns.Fqdn(name), qtype)
-	m.RecursionDesired = true
+// queryLimiter paces all outgoing DNS queries when set (-rate).
+var queryLimiter *time.Ticker
 
-	rctx, cancel := context.WithTimeout(ctx, client.Timeout)
-	defer cancel()
+func waitQuerySlot(ctx context.Context) error {
+	if queryLimiter == nil {
+		return nil
+	}
+	select {
+	case <-queryLimiter.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	in, _, err := client.ExchangeContext(rctx, m, resolver)
-	if err != nil {
+func queryType(ctx context.Context, client *dns.Client, resolver, name string, qtype uint16) ([]dns.RR, error) {
+	in, err := queryRecursive(ctx, client, resolver, name, qtype)
+	if err = answerError(in, err); err != nil {
 		return nil, err
 	}
-	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
-		return nil, fmt.Errorf("dns rcode %s", dns.RcodeToString[in.Rcode])
-	}
 	var out []dns.RR
 	out = append(out, in.Answer...)
 	out = append(out, in.Extra...)
 	return out, nil
 }
 
-func printRRs(rrs []dns.RR, err error) {
-	if err != nil {
-		fmt.Printf("error: %v\n", err)
-		return
-	}
-	if len(rrs) == 0 {
-		fmt.Println("(geen records)")
-		return
-	}
-	for _, rr := range rrs {
-		// Only print answer-ish records (skip OPT).
-		if rr.Header() != nil && rr.Header().Rrtype == dns.TypeOPT {
-			continue
-		}
-		fmt.Println(rr.String())
+// queryRecursive sends a query with RD set and returns the whole response,
+// for callers that need the authority section or the rcode.
+func queryRecursive(ctx context.Context, client *dns.Client, resolver, name string, qtype uint16) (*dns.Msg, error) {
+	if err := waitQuerySlot(ctx); err != nil {
+		return nil, err
 	}
-}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = true
 
-func runAllDNS(ctx context.Context, client *dns.Client, resolver, domain string) error {
-	type q struct {
-		name  string
-		qtype uint16
-	}
-	queries := []q{
-		{"A", dns.TypeA},
-		{"AAAA", dns.TypeAAAA},
-		{"CNAME", dns.TypeCNAME},
-		{"MX", dns.TypeMX},
-		{"NS", dns.TypeNS},
-		{"TXT", dns.TypeTXT},
-		{"SOA", dns.TypeSOA},
-		{"CAA", dns.TypeCAA},
-	}
+	rctx, cancel := context.WithTimeout(ctx, client.Timeout)
+	defer cancel()
 
-	for _, qu := range queries {
-		fmt.Printf("\n-- %s --\n", qu.name)
-		printRRs(queryType(ctx, client, resolver, domain, qu.qtype))
+	in, _, err := client.ExchangeContext(rctx, m, resolver)
+	return in, err
+}
+
+func runAllDNS(ctx context.Context, client *dns.Client, r *dnsReport) error {
+	for _, q := range r.Queries {
+		fmt.Printf("\n-- %s --\n", q.Type)
+		printQueryResult(q)
+		if q.Type == "A" || q.Type == "AAAA" {
+			printIPOwners(r, extractIPs(q.RRs()), "  ")
+		}
 	}
 
 	fmt.Printf("\n-- SRV (bekende services) --\n")
-	if err := runCommonSRV(ctx, client, resolver, domain); err != nil {
-		fmt.Printf("SRV: error: %v\n", err)
-	}
+	printSRVResults(ctx, client, r.Resolver, r.SRV)
+	printSRVErrors(r.srv.Failed)
 
 	fmt.Printf("\n-- MAIL CHECKS --\n")
-	return mailChecks(ctx, client, resolver, domain)
+	if r.Mail != nil {
+		printMail(r, *r.Mail)
+	}
+	return nil
 }
 
-func mailChecks(ctx context.Context, client *dns.Client, resolver, domain string) error {
-	// SPF: TXT record containing v=spf1
-	txt, err := queryType(ctx, client, resolver, domain, dns.TypeTXT)
-	if err != nil {
-		fmt.Printf("SPF: error: %v\n", err)
-	} else {
-		spf := findTXTContains(txt, "v=spf1")
-		if spf == "" {
-			fmt.Println("SPF: niet gevonden")
-		} else {
-			fmt.Printf("SPF: %s\n", spf)
+type mailReport struct {
+	SPF    string            `json:"spf,omitempty"`
+	DMARC  string            `json:"dmarc,omitempty"`
+	DKIM   []dkimKey         `json:"dkim,omitempty"`
+	MX     []mxTarget        `json:"mx,omitempty"`
+	TLSRPT string            `json:"tls_rpt,omitempty"`
+	MTASTS string            `json:"mta_sts,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+	errs   map[string]error
+}
+
+type dkimKey struct {
+	Selector string `json:"selector"`
+	Record   string `json:"record"`
+}
+
+type mxTarget struct {
+	Host string   `json:"host"`
+	IPs  []string `json:"ips,omitempty"`
+}
+
+// dkimSelectors: we kunnen selectors niet “allemaal” weten; check een set common selectors.
+var dkimSelectors = []string{"default", "selector1", "selector2", "s1", "s2", "k1", "google"}
+
+func collectMail(ctx context.Context, client *dns.Client, resolver, domain string) mailReport {
+	m := mailReport{Errors: map[string]string{}, errs: map[string]error{}}
+
+	txtRecord := func(check, name, needle string) string {
+		rrs, err := queryType(ctx, client, resolver, name, dns.TypeTXT)
+		if err != nil {
+			m.Errors[check], m.errs[check] = err.Error(), err
+			return ""
 		}
+		return findTXTContains(rrs, needle)
 	}
 
+	// SPF: TXT record containing v=spf1
+	m.SPF = txtRecord("SPF", domain, "v=spf1")
 	// DMARC: _dmarc.domain TXT
-	dmarcName := "_dmarc." + domain
-	dmarc, err := queryType(ctx, client, resolver, dmarcName, dns.TypeTXT)
-	if err != nil {
-		fmt.Printf("DMARC: error: %v\n", err)
-	} else {
-		v := findTXTContains(dmarc, "v=DMARC1")
-		if v == "" {
-			fmt.Println("DMARC: niet gevonden")
-		} else {
-			fmt.Printf("DMARC: %s\n", v)
-		}
-	}
+	m.DMARC = txtRecord("DMARC", "_dmarc."+domain, "v=DMARC1")
 
-	// DKIM: we kunnen selectors niet “allemaal” weten; check een set common selectors.
-	dkimSelectors := []string{"default", "selector1", "selector2", "s1", "s2", "k1", "google"}
-	foundDKIM := false
 	for _, sel := range dkimSelectors {
 		name := sel + "._domainkey." + domain
 		rrs, err := queryType(ctx, client, resolver, name, dns.TypeTXT)
 		if err != nil {
+			m.Errors["DKIM "+sel], m.errs["DKIM "+sel] = err.Error(), err
 			continue
 		}
-		v := findTXTContains(rrs, "v=DKIM1")
-		if v != "" {
-			if !foundDKIM {
-				fmt.Println("DKIM:")
-				foundDKIM = true
-			}
-			fmt.Printf("  - %s: %s\n", sel, v)
+		if v := findTXTContains(rrs, "v=DKIM1"); v != "" {
+			m.DKIM = append(m.DKIM, dkimKey{Selector: sel, Record: v})
 		}
 	}
-	if !foundDKIM {
-		fmt.Println("DKIM: niet gevonden (common selectors)")
-	}
 
 	// MX existence + resolve targets
-	mx, err := queryType(ctx, client, resolver, domain, dns.TypeMX)
+	mx, err := collectMXTargets(ctx, client, resolver, domain)
 	if err != nil {
-		fmt.Printf("MX: error: %v\n", err)
-	} else {
-		mxHosts := extractMXHosts(mx)
-		if len(mxHosts) == 0 {
-			fmt.Println("MX: niet gevonden")
-		} else {
-			fmt.Printf("MX: %d record(s)\n", len(mxHosts))
-			for _, h := range mxHosts {
-				fmt.Printf("  - %s\n", h)
-				a, _ := queryType(ctx, client, resolver, h, dns.TypeA)
-				aaaa, _ := queryType(ctx, client, resolver, h, dns.TypeAAAA)
-				if len(a) == 0 && len(aaaa) == 0 {
-					fmt.Printf("    resolve: geen A/AAAA\n")
-				} else {
-					ips := append(extractIPs(a), extractIPs(aaaa)...)
-					if len(ips) > 0 {
-						fmt.Printf("    resolve: %s\n", strings.Join(ips, ", "))
-					}
-				}
-			}
-		}
+		m.Errors["MX"], m.errs["MX"] = err.Error(), err
 	}
+	m.MX = mx
 
 	// TLS-RPT: _smtp._tls.domain TXT
-	tlsRptName := "_smtp._tls." + domain
-	tlsRpt, err := queryType(ctx, client, resolver, tlsRptName, dns.TypeTXT)
+	m.TLSRPT = txtRecord("TLS-RPT", "_smtp._tls."+domain, "v=TLSRPTv1")
+	// MTA-STS TXT: _mta-sts.domain
+	m.MTASTS = txtRecord("MTA-STS", "_mta-sts."+domain, "v=STSv1")
+
+	if len(m.Errors) == 0 {
+		m.Errors = nil
+	}
+	return m
+}
+
+func collectMXTargets(ctx context.Context, client *dns.Client, resolver, domain string) ([]mxTarget, error) {
+	mx, err := queryType(ctx, client, resolver, domain, dns.TypeMX)
 	if err != nil {
-		fmt.Printf("TLS-RPT: error: %v\n", err)
-	} else {
-		v := findTXTContains(tlsRpt, "v=TLSRPTv1")
-		if v == "" {
-			fmt.Println("TLS-RPT: niet gevonden")
+		return nil, err
+	}
+	var out []mxTarget
+	for _, h := range extractMXHosts(mx) {
+		v4, v6 := resolveHost(ctx, client, resolver, h)
+		out = append(out, mxTarget{Host: h, IPs: append(v4, v6...)})
+	}
+	return out, nil
+}
+
+func printMail(r *dnsReport, m mailReport) {
+	printTXTCheck := func(check, value string) {
+		if err, ok := m.Errors[check]; ok {
+			fmt.Printf("%s: error: %s\n", check, err)
+		} else if value == "" {
+			fmt.Printf("%s: niet gevonden\n", check)
 		} else {
-			fmt.Printf("TLS-RPT: %s\n", v)
+			fmt.Printf("%s: %s\n", check, value)
 		}
 	}
 
-	// MTA-STS TXT: _mta-sts.domain
-	mtaStsName := "_mta-sts." + domain
-	mtaSts, err := queryType(ctx, client, resolver, mtaStsName, dns.TypeTXT)
-	if err != nil {
-		fmt.Printf("MTA-STS: error: %v\n", err)
-	} else {
-		v := findTXTContains(mtaSts, "v=STSv1")
-		if v == "" {
-			fmt.Println("MTA-STS: niet gevonden")
-		} else {
-			fmt.Printf("MTA-STS: %s\n", v)
+	printFindings := func(indent string, findings []string) {
+		for _, f := range findings {
+			fmt.Printf("%s[!] %s\n", indent, f)
 		}
 	}
 
-	return nil
-}
+	printTXTCheck("SPF", m.SPF)
+	if m.SPF != "" {
+		printFindings("  ", checkSPF(m.SPF))
+	}
+	printTXTCheck("DMARC", m.DMARC)
+	if m.DMARC != "" {
+		printFindings("  ", checkDMARC(m.DMARC))
+	}
 
-func runCommonSRV(ctx context.Context, client *dns.Client, resolver, domain string) error {
-	labels := []string{
-		"_sip._tcp", "_sip._udp", "_sips._tcp",
-		"_submission._tcp", "_smtps._tcp",
-		"_imap._tcp", "_imaps._tcp", "_pop3._tcp", "_pop3s._tcp",
-		"_xmpp-client._tcp", "_xmpp-server._tcp",
-		"_autodiscover._tcp",
-		"_caldav._tcp", "_carddav._tcp",
-		"_ldap._tcp",
-		"_kerberos._udp", "_kerberos._tcp",
-		"_ntp._udp",
-	}
-
-	printedAny := false
-	for _, l := range labels {
-		qname := l + "." + domain
-		rrs, err := queryType(ctx, client, resolver, qname, dns.TypeSRV)
-		if err != nil || len(rrs) == 0 {
-			continue
-		}
-		// Only print if there is at least one SRV answer.
-		hasSRV := false
-		for _, rr := range rrs {
-			if _, ok := rr.(*dns.SRV); ok {
-				hasSRV = true
-				break
-			}
-		}
-		if !hasSRV {
-			continue
+	if len(m.DKIM) == 0 {
+		fmt.Println("DKIM: niet gevonden (common selectors)")
+	} else {
+		fmt.Println("DKIM:")
+		for _, k := range m.DKIM {
+			fmt.Printf("  - %s: %s\n", k.Selector, k.Record)
+			printFindings("    ", checkDKIM(k.Record))
 		}
+	}
 
-		if !printedAny {
-			printedAny = true
-		}
-		fmt.Printf("  %s\n", qname)
-		for _, rr := range rrs {
-			if rr.Header() != nil && rr.Header().Rrtype == dns.TypeOPT {
-				continue
+	if err, ok := m.Errors["MX"]; ok {
+		fmt.Printf("MX: error: %s\n", err)
+	} else if len(m.MX) == 0 {
+		fmt.Println("MX: niet gevonden")
+	} else {
+		fmt.Printf("MX: %d record(s)\n", len(m.MX))
+		for _, mx := range m.MX {
+			fmt.Printf("  - %s\n", mx.Host)
+			if len(mx.IPs) == 0 {
+				fmt.Printf("    resolve: geen A/AAAA\n")
+			} else {
+				fmt.Printf("    resolve: %s\n", strings.Join(mx.IPs, ", "))
+				printIPOwners(r, mx.IPs, "      ")
 			}
-			// Print SRV answers; extras (A/AAAA) are ok too.
-			fmt.Printf("    %s\n", rr.String())
 		}
 	}
 
-	if !printedAny {
-		fmt.Println("(geen SRV records gevonden voor bekende services)")
-	}
-	return nil
+	printTXTCheck("TLS-RPT", m.TLSRPT)
+	printTXTCheck("MTA-STS", m.MTASTS)
 }
 
 func findTXTContains(rrs []dns.RR, needle string) string {
@@ -537,37 +920,6 @@ func extractIPs(rrs []dns.RR) []string {
 	return out
 }
 
-func runWhois(domain string) error {
-	raw, err := whois.Whois(domain)
-	if err != nil {
-		return err
-	}
-	parsed, perr := whoisparser.Parse(raw)
-	if perr != nil {
-		// If parsing fails, show raw output.
-		fmt.Println(raw)
-		return nil
-	}
-
-	// Best-effort fields (parser varies by TLD/registrar).
-	d := parsed.Domain
-	r := parsed.Registrar
-
-	fmt.Printf("Domain: %s\n", safe(d.Domain))
-	fmt.Printf("Status: %s\n", strings.Join(nonEmpty(d.Status), ", "))
-	fmt.Printf("Created: %s\n", safe(d.CreatedDate))
-	fmt.Printf("Updated: %s\n", safe(d.UpdatedDate))
-	fmt.Printf("Expires: %s\n", safe(d.ExpirationDate))
-	fmt.Printf("Registrar: %s\n", safe(r.Name))
-	if len(d.NameServers) > 0 {
-		fmt.Printf("NameServers:\n")
-		for _, ns := range d.NameServers {
-			fmt.Printf("  - %s\n", ns)
-		}
-	}
-	return nil
-}
-
 func safe(s string) string {
 	if strings.TrimSpace(s) == "" {
 		return "-"
@@ -584,71 +936,3 @@ func nonEmpty(in []string) []string {
 	}
 	return out
 }
-
-func fetchSubdomainsCT(ctx context.Context, domain string) ([]string, error) {
-	// crt.sh output=json returns an array of objects containing name_value
-	// endpoint: https://crt.sh/?q=%25.example.com&output=json
-	u := "https://crt.sh/?q=%25." + domain + "&output=json"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", "ultradns/"+version)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return nil, fmt.Errorf("crt.sh status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// Sometimes crt.sh returns invalid JSON when empty or rate-limited.
-	var rows []map[string]any
-	if err := json.Unmarshal(body, &rows); err != nil {
-		trim := strings.TrimSpace(string(body))
-		if trim == "" || strings.Contains(strings.ToLower(trim), "rate") {
-			return nil, errors.New("crt.sh gaf geen geldige JSON (mogelijk rate limit)")
-		}
-		return nil, err
-	}
-
-	set := map[string]struct{}{}
-	for _, row := range rows {
-		v, ok := row["name_value"]
-		if !ok {
-			continue
-		}
-		s, _ := v.(string)
-		if s == "" {
-			continue
-		}
-		// name_value can contain multiple lines
-		for _, line := range strings.Split(s, "\n") {
-			line = strings.TrimSpace(line)
-			line = strings.TrimPrefix(line, "*.")
-			line = strings.TrimSuffix(line, ".")
-			if line == "" {
-				continue
-			}
-			if !strings.HasSuffix(line, domain) {
-				continue
-			}
-			set[line] = struct{}{}
-		}
-	}
-
-	out := make([]string, 0, len(set))
-	for k := range set {
-		out = append(out, k)
-	}
-	sort.Strings(out)
-	return out, nil
-}
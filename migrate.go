@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// migrationNames collects the names to compare and the types to ask for
+// each: everything in the zone file, the subdomains from sources (none
+// without -subs), and the SRV, DKIM and mail policy names that are usually
+// not visible anywhere else.
+func migrationNames(ctx context.Context, domain, zoneFile, origin string, sources []subdomainSource, srvCatalogue []srvService) (map[string]map[uint16]bool, []string, error) {
+	apex := dns.Fqdn(strings.ToLower(domain))
+	names := map[string]map[uint16]bool{}
+	add := func(name string, types ...uint16) {
+		name = dns.Fqdn(strings.ToLower(name))
+		if !dns.IsSubDomain(apex, name) {
+			return
+		}
+		if names[name] == nil {
+			names[name] = map[uint16]bool{}
+		}
+		for _, t := range types {
+			names[name][t] = true
+		}
+	}
+	var notes []string
+
+	add(apex, dns.TypeSOA, dns.TypeNS)
+	add(apex, driftProbeTypes...)
+
+	if zoneFile != "" {
+		if origin == "" {
+			origin = domain
+		}
+		rrs, _, err := loadZoneFile(zoneFile, origin)
+		if err != nil {
+			return nil, nil, err
+		}
+		sets := zoneRRsets(apex, rrs)
+		for name, types := range sets {
+			for t := range types {
+				add(name, t)
+			}
+			if len(types[dns.TypeNS]) == 0 {
+				add(name, driftProbeTypes...)
+			}
+		}
+		notes = append(notes, fmt.Sprintf("zone file: %d namen", len(sets)))
+	}
+
+	if len(sources) > 0 {
+		res, err := fetchSubdomains(ctx, domain, sources)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("CT: %v (overgeslagen)", err))
+		} else {
+			for _, s := range res.Names {
+				add(s, driftProbeTypes...)
+			}
+			notes = append(notes, fmt.Sprintf("CT: %d namen", len(res.Names)))
+		}
+	}
+
+	for _, svc := range srvCatalogue {
+		add(svc.Label+"."+domain, dns.TypeSRV)
+	}
+	for _, sel := range dkimSelectors {
+		add(sel+"._domainkey."+domain, dns.TypeTXT, dns.TypeCNAME)
+	}
+	for _, label := range []string{"_dmarc", "_mta-sts", "_smtp._tls"} {
+		add(label+"."+domain, dns.TypeTXT)
+	}
+	notes = append(notes, fmt.Sprintf("catalogus: %d SRV labels, %d DKIM selectors", len(srvCatalogue), len(dkimSelectors)))
+	return names, notes, nil
+}
+
+// migrationDiff is one name/type where a server disagrees with the
+// reference answer of the old provider.
+type migrationDiff struct {
+	Owner  string   `json:"owner"`
+	Type   string   `json:"type"`
+	Server string   `json:"server"`
+	Side   string   `json:"side"` // old or new
+	Kind   string   `json:"kind"` // missing, extra, different or error
+	Old    []string `json:"old,omitempty"`
+	New    []string `json:"new,omitempty"`
+	Detail string   `json:"detail,omitempty"`
+}
+
+func (d migrationDiff) String() string {
+	key := d.Owner + " " + d.Type
+	prefix := ""
+	if d.Side == "old" {
+		prefix = "(oud onderling) "
+	}
+	switch d.Kind {
+	case "missing":
+		return fmt.Sprintf("- %s%s ontbreekt bij %s: %s", prefix, key, d.Server, strings.Join(d.Old, " | "))
+	case "extra":
+		return fmt.Sprintf("+ %s%s alleen bij %s: %s", prefix, key, d.Server, strings.Join(d.New, " | "))
+	case "error":
+		return fmt.Sprintf("! %s%s bij %s: %s", prefix, key, d.Server, d.Detail)
+	}
+	if d.Detail != "" && len(d.Old) == 0 {
+		return fmt.Sprintf("~ %s%s bij %s: %s", prefix, key, d.Server, d.Detail)
+	}
+	return fmt.Sprintf("~ %s%s bij %s: oud [%s] nieuw [%s]", prefix, key, d.Server, strings.Join(d.Old, " | "), strings.Join(d.New, " | "))
+}
+
+// compareProviders asks every old and new server for every name/type. The
+// first old server that answers is the reference. The apex NS, SOA and DS sets
+// are expected to change with the provider and are not compared.
+func compareProviders(ctx context.Context, client *dns.Client, apex string, names map[string]map[uint16]bool, oldSrc, newSrc []dnsSource) []migrationDiff {
+	var out []migrationDiff
+	for _, name := range sortedNameSet(names) {
+		for _, t := range sortedTypeSet(names[name]) {
+			if name == apex && (t == dns.TypeNS || t == dns.TypeSOA || t == dns.TypeDS) {
+				continue
+			}
+
+			var ref []dns.RR
+			haveRef := false
+			type answer struct {
+				src  dnsSource
+				side string
+				rrs  []dns.RR
+				err  error
+			}
+			var answers []answer
+			for _, side := range []struct {
+				name string
+				srcs []dnsSource
+			}{{"old", oldSrc}, {"new", newSrc}} {
+				for _, src := range side.srcs {
+					rrs, err := src.lookup(ctx, client, name, t)
+					answers = append(answers, answer{src, side.name, rrs, err})
+					if err == nil && side.name == "old" && !haveRef {
+						ref, haveRef = rrs, true
+					}
+				}
+			}
+			if !haveRef {
+				out = append(out, migrationDiff{Owner: name, Type: dns.TypeToString[t], Server: "oud", Side: "old", Kind: "error", Detail: "geen enkele oude server antwoordt"})
+				continue
+			}
+
+			for _, a := range answers {
+				d := migrationDiff{Owner: name, Type: dns.TypeToString[t], Server: a.src.String(), Side: a.side}
+				if a.err != nil {
+					d.Kind, d.Detail = "error", a.err.Error()
+					out = append(out, d)
+					continue
+				}
+				missing, extra, detail := rrsetDiff(ref, a.rrs, true)
+				switch {
+				case len(ref) > 0 && len(a.rrs) == 0:
+					d.Kind, d.Old = "missing", rrDataList(ref)
+				case len(ref) == 0 && len(a.rrs) > 0:
+					d.Kind, d.New = "extra", rrDataList(a.rrs)
+				case len(missing) > 0 || len(extra) > 0:
+					d.Kind, d.Old, d.New = "different", rrDataList(ref), rrDataList(a.rrs)
+				case detail != "":
+					d.Kind, d.Detail = "different", detail
+				default:
+					continue
+				}
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+func sortedNameSet(m map[string]map[uint16]bool) []string {
+	sets := make(map[string]map[uint16][]dns.RR, len(m))
+	for n := range m {
+		sets[n] = nil
+	}
+	return sortedNames(sets)
+}
+
+// runMigrateCmd implements "ultradns migrate". Exit codes: 0 the new
+// provider serves the same data, 1 differences or errors, 2 usage error.
+func runMigrateCmd(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var domain, zoneFile, resolverFlag, srvFile string
+	var oldNS, newNS, srvLabels stringList
+	var subsOpts options
+	var useCT, asJSON bool
+	var timeout time.Duration
+	fs.StringVar(&domain, "d", "", "Domein")
+	fs.Var(&oldNS, "old", "Huidige nameservers (host of ip[:port]; default: de live NS set)")
+	fs.Var(&newNS, "new", "Nieuwe nameservers (host of ip[:port], komma-gescheiden of herhaalbaar)")
+	fs.StringVar(&zoneFile, "zone", "", "Zone file met de namen die vergeleken moeten worden")
+	fs.BoolVar(&useCT, "subs", true, "Neem subdomeinen uit certificate transparency mee")
+	fs.Var(&subsOpts.subsSources, "subs-sources", "Subdomein bronnen: crtsh, certspotter (API key via CERTSPOTTER_API_KEY). Default: crtsh")
+	fs.StringVar(&subsOpts.subsConfig, "subs-config", "", "Subdomein bronnen uit YAML: type, name, url, api_key(_env), rate per bron")
+	fs.Var(&subsOpts.subsImport, "subs-import", "Subdomeinen uit een eerder gedownloade JSON dump lezen (crt.sh, Cert Spotter, lijst of -json output)")
+	fs.StringVar(&srvFile, "srv-file", "", "Bestand met SRV labels (vervangt de ingebouwde lijst)")
+	fs.Var(&srvLabels, "srv-label", "Extra SRV label(s)")
+	fs.StringVar(&resolverFlag, "r", "", "Resolver voor NS/hostnaam lookups. Default: systeem resolvers of 8.8.8.8:53")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Timeout per query")
+	fs.BoolVar(&asJSON, "json", false, "Output als JSON")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns migrate -d <domein> -new ns1.nieuw.net,ns2.nieuw.net [-old ...] [-zone zone.db]\n\n")
+		fmt.Fprintf(os.Stderr, "Vergelijkt de oude en nieuwe nameservers voordat je de NS bij de registrar wijzigt.\n")
+		fmt.Fprintf(os.Stderr, "Namen komen uit de zone file, certificate transparency en de SRV/DKIM catalogus.\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = identiek, 1 = verschillen of fouten, 2 = fout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if domain == "" || len(newNS) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	domain = normalizeDomain(domain)
+	apex := dns.Fqdn(strings.ToLower(domain))
+
+	srvCatalogue, err := loadSRVCatalogue(srvFile, srvLabels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	var sources []subdomainSource
+	if useCT {
+		if sources, err = subdomainSources(subsOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	client := &dns.Client{Timeout: timeout}
+	resolver := pickResolver(resolverFlag)
+
+	oldSrc, err := authSources(ctx, client, resolver, domain, oldNS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: oude nameservers: %v\n", err)
+		return exitUsage
+	}
+	newSrc, err := authSources(ctx, client, resolver, domain, newNS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: nieuwe nameservers: %v\n", err)
+		return exitUsage
+	}
+
+	names, notes, err := migrationNames(ctx, domain, zoneFile, "", sources, srvCatalogue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	diffs := compareProviders(ctx, client, apex, names, oldSrc, newSrc)
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, map[string]any{
+			"domain": domain, "old": oldSrc, "new": newSrc, "names": len(names), "sources": notes, "differences": diffs,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	} else {
+		printBanner()
+		printHeader("NS MIGRATIE " + domain)
+		fmt.Printf("oud:   %s\n", joinSources(oldSrc))
+		fmt.Printf("nieuw: %s\n", joinSources(newSrc))
+		fmt.Printf("namen: %d (%s)\n\n", len(names), strings.Join(notes, "; "))
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+		if len(diffs) == 0 {
+			fmt.Println("Geen verschillen: de nieuwe nameservers serveren dezelfde data. De NS wijziging bij de registrar is veilig.")
+		} else {
+			fmt.Printf("\n[!] %d verschil(len): los deze op voordat je de NS bij de registrar wijzigt.\n", len(diffs))
+		}
+	}
+
+	if len(diffs) > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func joinSources(srcs []dnsSource) string {
+	parts := make([]string, 0, len(srcs))
+	for _, s := range srcs {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, ", ")
+}
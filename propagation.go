@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultPropagationResolvers are large public resolvers; each is anycast,
+// so one observation is one of many caches behind the address.
+var defaultPropagationResolvers = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9", "208.67.222.222"}
+
+// resolverState is what one resolver returns compared with the
+// authoritative answer.
+type resolverState struct {
+	Resolver  string
+	Current   bool
+	Records   []string
+	Negative  bool // cached NXDOMAIN/NODATA
+	Remaining uint32
+	ETA       time.Time
+	Error     string
+}
+
+// zoneOf returns the zone name belongs to: name itself when it has an NS
+// set, otherwise the closest enclosing zone.
+func zoneOf(ctx context.Context, client *dns.Client, resolver, name string) (string, error) {
+	rrs, err := queryType(ctx, client, resolver, name, dns.TypeNS)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range rrs {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, dns.Fqdn(name)) {
+			return dns.Fqdn(strings.ToLower(name)), nil
+		}
+	}
+	zone, _, err := findZoneCut(ctx, client, resolver, name)
+	if err != nil {
+		return "", err
+	}
+	return dns.Fqdn(strings.ToLower(zone)), nil
+}
+
+// cnameChain returns the CNAMEs in rrs from name onwards and the qtype
+// records at the end of the chain, as far as rrs contains them.
+func cnameChain(rrs []dns.RR, name string, qtype uint16) []dns.RR {
+	var out []dns.RR
+	owner := dns.Fqdn(name)
+	for hops := 0; hops < 8 && owner != ""; hops++ {
+		next := ""
+		for _, rr := range rrs {
+			if !strings.EqualFold(rr.Header().Name, owner) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype {
+				out = append(out, rr)
+			} else if c, ok := rr.(*dns.CNAME); ok {
+				out = append(out, rr)
+				next = c.Target
+			}
+		}
+		owner = next
+	}
+	return out
+}
+
+// chainData formats a chain, marking the CNAMEs.
+func chainData(rrs []dns.RR) []string {
+	out := rrDataList(rrs)
+	for i, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeCNAME {
+			out[i] = "CNAME " + out[i]
+		}
+	}
+	return out
+}
+
+// observeResolver asks a resolver for name/qtype. The CNAME chain counts as
+// part of the answer, but only for the names ref covers: an authoritative
+// server does not answer for an out-of-zone CNAME target. When the answer
+// differs from ref, the remaining TTL of what it returned (or of the SOA for
+// a cached negative answer, RFC 2308) is when that cache entry expires.
+func observeResolver(ctx context.Context, client *dns.Client, resolver, name string, qtype uint16, ref []dns.RR) resolverState {
+	st := resolverState{Resolver: resolver}
+	in, err := queryRecursive(ctx, client, resolver, name, qtype)
+	if err = answerError(in, err); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+
+	rrs := cnameChain(in.Answer, name, qtype)
+	st.Records = chainData(rrs)
+
+	owners := map[string]bool{strings.ToLower(dns.Fqdn(name)): true}
+	for _, rr := range ref {
+		owners[strings.ToLower(rr.Header().Name)] = true
+	}
+	var compared []dns.RR
+	for _, rr := range rrs {
+		if owners[strings.ToLower(rr.Header().Name)] {
+			compared = append(compared, rr)
+		}
+	}
+
+	// A CNAME to a name without qtype records is still an answer; only
+	// an empty chain is a cached NXDOMAIN/NODATA for name itself.
+	if len(rrs) > 0 {
+		st.Remaining = rrs[0].Header().Ttl
+	} else {
+		st.Negative = true
+		for _, rr := range in.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				st.Remaining = soa.Hdr.Ttl
+			}
+		}
+	}
+
+	missing, extra, _ := rrsetDiff(ref, compared, false)
+	st.Current = len(missing) == 0 && len(extra) == 0
+	if !st.Current {
+		// The stale entry that lives longest decides when it is gone.
+		for i, rr := range extra {
+			if i == 0 || rr.Header().Ttl > st.Remaining {
+				st.Remaining = rr.Header().Ttl
+			}
+		}
+		st.ETA = time.Now().Add(time.Duration(st.Remaining) * time.Second)
+	}
+	return st
+}
+
+// runPropagationCmd implements "ultradns propagation". Exit codes: 0 all
+// resolvers agree with the authoritative servers, 1 they still disagree
+// after -max, 2 error.
+func runPropagationCmd(args []string) int {
+	fs := flag.NewFlagSet("propagation", flag.ExitOnError)
+	var name, qtypeName, resolverFlag string
+	var resolvers, servers stringList
+	var interval, maxWait, timeout time.Duration
+	var once, delegationChange bool
+	fs.StringVar(&name, "d", "", "Naam die gewijzigd is (bijv. www.example.com)")
+	fs.StringVar(&qtypeName, "t", "A", "Record type")
+	fs.Var(&resolvers, "resolvers", "Recursieve resolvers om te volgen (ip[:port], komma-gescheiden; default: "+strings.Join(defaultPropagationResolvers, ", ")+")")
+	fs.Var(&servers, "server", "Authoritative server(s) i.p.v. de live NS set")
+	fs.BoolVar(&delegationChange, "delegation", false, "Het gaat om een NS wijziging bij de registrar: neem de TTL van de parent NS set mee")
+	fs.DurationVar(&interval, "interval", 30*time.Second, "Tijd tussen polls")
+	fs.DurationVar(&maxWait, "max", 0, "Stop na deze tijd (default: de berekende worst case + 1 interval)")
+	fs.BoolVar(&once, "once", false, "Alleen de ETA berekenen, niet pollen")
+	fs.StringVar(&resolverFlag, "r", "", "Resolver voor NS lookups. Default: systeem resolvers of 8.8.8.8:53")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Timeout per query")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns propagation -d <naam> [-t A] [-resolvers 1.1.1.1,8.8.8.8] [-delegation]\n\n")
+		fmt.Fprintf(os.Stderr, "Berekent per resolver wanneer de oude data uit de cache verloopt (op basis van de TTL's)\n")
+		fmt.Fprintf(os.Stderr, "en pollt tot alle resolvers hetzelfde antwoorden als de authoritative servers.\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = overal actueel, 1 = na -max nog niet overal actueel, 2 = fout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	qtype, ok := dns.StringToType[strings.ToUpper(qtypeName)]
+	if name == "" || !ok {
+		fs.Usage()
+		return exitUsage
+	}
+	name = dns.Fqdn(strings.ToLower(normalizeDomain(name)))
+	if len(resolvers) == 0 {
+		resolvers = defaultPropagationResolvers
+	}
+	for i, r := range resolvers {
+		resolvers[i] = pickResolver(r)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	client := &dns.Client{Timeout: timeout}
+	resolver := pickResolver(resolverFlag)
+
+	zone, err := zoneOf(ctx, client, resolver, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: zone van %s: %v\n", name, err)
+		return exitUsage
+	}
+	srcs, err := authSources(ctx, client, resolver, zone, servers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	printBanner()
+	printHeader(fmt.Sprintf("PROPAGATIE %s %s", name, dns.TypeToString[qtype]))
+	fmt.Printf("zone: %s | authoritative: %s\n", zone, joinSources(srcs))
+
+	// The first answering authoritative server is the reference; the
+	// others should agree, or resolvers will flip between answers.
+	var ref []dns.RR
+	haveRef := false
+	for _, src := range srcs {
+		answer, err := src.answer(ctx, client, name, qtype)
+		if err != nil {
+			fmt.Printf("  [!] %s: %v\n", src, err)
+			continue
+		}
+		rrs := cnameChain(answer, name, qtype)
+		if !haveRef {
+			ref, haveRef = rrs, true
+			continue
+		}
+		if missing, extra, _ := rrsetDiff(ref, rrs, false); len(missing)+len(extra) > 0 {
+			fmt.Printf("  [!] %s geeft een ander antwoord: [%s]\n", src, strings.Join(chainData(rrs), " | "))
+		}
+	}
+	if !haveRef {
+		fmt.Println("error: geen enkele authoritative server antwoordt")
+		return exitUsage
+	}
+
+	var authTTL uint32
+	if len(ref) > 0 {
+		authTTL = ref[0].Header().Ttl
+		fmt.Printf("authoritative antwoord (TTL %ds): %s\n", authTTL, strings.Join(chainData(ref), " | "))
+	} else {
+		fmt.Println("authoritative antwoord: (geen records)")
+	}
+
+	worst := time.Duration(authTTL) * time.Second
+	if delegationChange || (qtype == dns.TypeNS && name == zone) {
+		del, err := parentDelegation(ctx, client, resolver, strings.TrimSuffix(zone, "."))
+		if err != nil {
+			fmt.Printf("  [!] parent delegatie: %v\n", err)
+		} else {
+			fmt.Printf("parent (%s) NS TTL: %ds, resolvers kunnen de oude delegatie zo lang vasthouden\n", del.Parent, del.NSTTL)
+			if d := time.Duration(del.NSTTL) * time.Second; d > worst {
+				worst = d
+			}
+		}
+	}
+	fmt.Printf("worst case voor caches die hier niet zichtbaar zijn: %s na de wijziging (of de oude TTL als die hoger was)\n\n", worst)
+
+	deadline := time.Time{}
+	if maxWait > 0 {
+		deadline = time.Now().Add(maxWait)
+	}
+	for round := 1; ; round++ {
+		var states []resolverState
+		allCurrent := true
+		var latest time.Time
+		for _, r := range resolvers {
+			st := observeResolver(ctx, client, r, name, qtype, ref)
+			states = append(states, st)
+			if !st.Current {
+				allCurrent = false
+			}
+			if st.ETA.After(latest) {
+				latest = st.ETA
+			}
+		}
+
+		fmt.Printf("ronde %d (%s):\n", round, time.Now().Format("15:04:05"))
+		for _, st := range states {
+			switch {
+			case st.Error != "":
+				fmt.Printf("  %-22s fout     %s\n", st.Resolver, st.Error)
+			case st.Current:
+				fmt.Printf("  %-22s actueel  (TTL rest %ds)\n", st.Resolver, st.Remaining)
+			default:
+				what := "[" + strings.Join(st.Records, " | ") + "]"
+				if st.Negative {
+					what = "negatief gecached (NXDOMAIN/NODATA)"
+				}
+				fmt.Printf("  %-22s oud      rest %ds, ETA %s  %s\n", st.Resolver, st.Remaining, st.ETA.Format("15:04:05"), what)
+			}
+		}
+
+		if allCurrent {
+			fmt.Println("\nAlle resolvers geven het authoritative antwoord.")
+			return exitOK
+		}
+		if !latest.IsZero() {
+			fmt.Printf("verwacht klaar: %s (over %s)\n", latest.Format("15:04:05"), time.Until(latest).Round(time.Second))
+		}
+		if once {
+			return exitFindings
+		}
+		if deadline.IsZero() {
+			deadline = latest.Add(interval)
+			if latest.IsZero() {
+				deadline = time.Now().Add(worst + interval)
+			}
+		}
+		if time.Now().Add(interval).After(deadline) {
+			if maxWait > 0 {
+				fmt.Printf("\n[!] na %s (-max) nog niet overal actueel\n", maxWait)
+			} else {
+				fmt.Println("\n[!] na de verwachte ETA nog niet overal actueel; een resolver houdt zich mogelijk niet aan de TTL (serve-stale)")
+			}
+			return exitFindings
+		}
+		fmt.Println()
+
+		select {
+		case <-ctx.Done():
+			return exitFindings
+		case <-time.After(interval):
+		}
+	}
+}
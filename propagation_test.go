@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCNAMEChain(t *testing.T) {
+	var rrs []dns.RR
+	for _, s := range []string{
+		"www.example.com. 300 IN CNAME Edge.example.net.",
+		"edge.example.net. 60 IN CNAME lb.example.org.",
+		"lb.example.org. 30 IN A 192.0.2.1",
+		"other.example.com. 300 IN A 192.0.2.9",
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	if got := strings.Join(chainData(cnameChain(rrs, "www.example.com", dns.TypeA)), " | "); got != "CNAME Edge.example.net. | CNAME lb.example.org. | 192.0.2.1" {
+		t.Errorf("A chain = %s", got)
+	}
+	if got := cnameChain(rrs, "www.example.com", dns.TypeCNAME); len(got) != 1 {
+		t.Errorf("CNAME query = %v, want only the CNAME at the name", got)
+	}
+	if got := cnameChain(rrs, "missing.example.com", dns.TypeA); len(got) != 0 {
+		t.Errorf("missing name = %v, want nothing", got)
+	}
+}
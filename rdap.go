@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRDAPBootstrap = "https://data.iana.org/rdap/"
+	rdapBootstrapMaxAge  = 24 * time.Hour
+)
+
+var errNoRDAPService = errors.New("geen RDAP server bekend in de IANA bootstrap registry")
+
+// rdapBootstrap mirrors the IANA bootstrap files (RFC 9224):
+// {"services": [[["com","net"], ["https://rdap.verisign.com/com/v1/"]], ...]}
+type rdapBootstrap struct {
+	Services [][][]string `json:"services"`
+}
+
+// rdapResponse covers the fields we use from domain, ip network and autnum
+// objects (RFC 9083).
+type rdapResponse struct {
+	Handle       string        `json:"handle"`
+	LDHName      string        `json:"ldhName"`
+	Name         string        `json:"name"`
+	Country      string        `json:"country"`
+	StartAddress string        `json:"startAddress"`
+	EndAddress   string        `json:"endAddress"`
+	StartAutnum  int64         `json:"startAutnum"`
+	EndAutnum    int64         `json:"endAutnum"`
+	Status       []string      `json:"status"`
+	Events       []rdapEvent   `json:"events"`
+	Entities     []rdapEntity  `json:"entities"`
+	Nameservers  []rdapNS      `json:"nameservers"`
+	SecureDNS    *rdapSecureNS `json:"secureDNS"`
+	Title        string        `json:"title"`
+}
+
+type rdapEvent struct {
+	Action string `json:"eventAction"`
+	Date   string `json:"eventDate"`
+}
+
+type rdapEntity struct {
+	Handle     string       `json:"handle"`
+	Roles      []string     `json:"roles"`
+	VCardArray []any        `json:"vcardArray"`
+	Entities   []rdapEntity `json:"entities"`
+}
+
+type rdapNS struct {
+	LDHName string `json:"ldhName"`
+}
+
+type rdapSecureNS struct {
+	DelegationSigned bool `json:"delegationSigned"`
+}
+
+// rdapQuery classifies the query and returns the bootstrap registry and the
+// RDAP path segment for it.
+func rdapQuery(q string) (kind, registry, path string) {
+	if ip := net.ParseIP(q); ip != nil {
+		if ip.To4() != nil {
+			return "ip", "ipv4", "ip/" + q
+		}
+		return "ip", "ipv6", "ip/" + q
+	}
+	if n, ok := parseASN(q); ok {
+		return "asn", "asn", "autnum/" + strconv.FormatInt(n, 10)
+	}
+	return "domain", "dns", "domain/" + strings.ToLower(q)
+}
+
+func parseASN(q string) (int64, bool) {
+	s := strings.TrimPrefix(strings.ToUpper(q), "AS")
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil && n >= 0
+}
+
+// lookupRDAP resolves the RDAP server (via o.rdapServer or the bootstrap
+// registry) and maps the response into a whoisResult.
+func lookupRDAP(ctx context.Context, query string, o options) (whoisResult, error) {
+	kind, registry, path := rdapQuery(query)
+	res := whoisResult{Query: query, Kind: kind, Source: "rdap"}
+
+	base := o.rdapServer
+	if base == "" {
+		bs, err := loadRDAPBootstrap(ctx, o.rdapBootstrap, registry)
+		if err != nil {
+			return res, fmt.Errorf("bootstrap: %w", err)
+		}
+		base = rdapServerFor(bs, kind, query)
+		if base == "" {
+			return res, errNoRDAPService
+		}
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + path
+	res.Server = u
+
+	body, status, err := rdapGet(ctx, u)
+	if err != nil {
+		return res, err
+	}
+	if status == http.StatusNotFound {
+		return res, fmt.Errorf("%s niet gevonden (404)", query)
+	}
+	var r rdapResponse
+	jerr := json.Unmarshal(body, &r)
+	if status != http.StatusOK {
+		return res, fmt.Errorf("status %d: %s", status, safe(r.Title))
+	}
+	if jerr != nil {
+		return res, fmt.Errorf("ongeldige JSON van %s: %w", u, jerr)
+	}
+
+	mapRDAP(&res, r)
+	return res, nil
+}
+
+func rdapGet(ctx context.Context, u string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+	req.Header.Set("User-Agent", "ultradns/"+version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+func mapRDAP(res *whoisResult, r rdapResponse) {
+	res.Handle = r.Handle
+	res.Domain = strings.ToLower(strings.TrimSuffix(r.LDHName, "."))
+	res.Name = r.Name
+	res.Country = r.Country
+	res.Status = r.Status
+	if r.SecureDNS != nil {
+		res.DNSSEC = r.SecureDNS.DelegationSigned
+	}
+
+	switch res.Kind {
+	case "ip":
+		if r.StartAddress != "" {
+			res.Range = r.StartAddress + " - " + r.EndAddress
+		}
+	case "asn":
+		if r.StartAutnum != 0 {
+			res.Range = fmt.Sprintf("AS%d - AS%d", r.StartAutnum, r.EndAutnum)
+		}
+	}
+
+	for _, ev := range r.Events {
+		switch ev.Action {
+		case "registration":
+			res.Created = ev.Date
+		case "expiration":
+			res.Expires = ev.Date
+		case "last changed":
+			res.Updated = ev.Date
+		}
+	}
+
+	for _, ns := range r.Nameservers {
+		if ns.LDHName != "" {
+			res.NameServers = append(res.NameServers, strings.ToLower(strings.TrimSuffix(ns.LDHName, ".")))
+		}
+	}
+
+	var walk func(ents []rdapEntity)
+	walk = func(ents []rdapEntity) {
+		for _, e := range ents {
+			we := whoisEntity{Handle: e.Handle, Roles: e.Roles, Name: vcardFN(e.VCardArray)}
+			res.Entities = append(res.Entities, we)
+			for _, role := range e.Roles {
+				if role == "registrar" && res.Registrar == "" {
+					res.Registrar = we.Name
+				}
+			}
+			walk(e.Entities)
+		}
+	}
+	walk(r.Entities)
+}
+
+// vcardFN extracts the "fn" (formatted name) from a jCard (RFC 7095):
+// ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Name"], ...]]
+func vcardFN(v []any) string {
+	if len(v) < 2 {
+		return ""
+	}
+	props, ok := v[1].([]any)
+	if !ok {
+		return ""
+	}
+	for _, p := range props {
+		prop, ok := p.([]any)
+		if !ok || len(prop) < 4 {
+			continue
+		}
+		if name, _ := prop[0].(string); name == "fn" {
+			s, _ := prop[3].(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// loadRDAPBootstrap returns the IANA bootstrap file for registry ("dns",
+// "ipv4", "ipv6" or "asn"). Files are cached in the user cache dir for a day;
+// a stale cache is still used when IANA cannot be reached.
+func loadRDAPBootstrap(ctx context.Context, baseURL, registry string) (rdapBootstrap, error) {
+	var bs rdapBootstrap
+	if baseURL == "" {
+		baseURL = defaultRDAPBootstrap
+	}
+
+	cachePath := ""
+	if dir, err := os.UserCacheDir(); err == nil && baseURL == defaultRDAPBootstrap {
+		cachePath = filepath.Join(dir, "ultradns", "rdap-"+registry+".json")
+	}
+
+	var stale []byte
+	if cachePath != "" {
+		if st, err := os.Stat(cachePath); err == nil {
+			if b, err := os.ReadFile(cachePath); err == nil {
+				if time.Since(st.ModTime()) < rdapBootstrapMaxAge {
+					if err := json.Unmarshal(b, &bs); err == nil {
+						return bs, nil
+					}
+				}
+				stale = b
+			}
+		}
+	}
+
+	body, status, err := rdapGet(ctx, strings.TrimSuffix(baseURL, "/")+"/"+registry+".json")
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("status %d", status)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &bs)
+	}
+	if err != nil {
+		if stale != nil && json.Unmarshal(stale, &bs) == nil {
+			return bs, nil
+		}
+		return bs, err
+	}
+
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			_ = os.WriteFile(cachePath, body, 0644)
+		}
+	}
+	return bs, nil
+}
+
+// rdapServerFor picks the most specific bootstrap entry: the longest
+// matching TLD/suffix for domains, the longest prefix for IPs and the
+// containing range for ASNs.
+func rdapServerFor(bs rdapBootstrap, kind, query string) string {
+	best, bestLen := "", -1
+	for _, svc := range bs.Services {
+		if len(svc) < 2 || len(svc[1]) == 0 {
+			continue
+		}
+		url := pickRDAPURL(svc[1])
+		for _, entry := range svc[0] {
+			n := rdapEntryMatch(kind, entry, query)
+			if n > bestLen {
+				best, bestLen = url, n
+			}
+		}
+	}
+	return best
+}
+
+// pickRDAPURL prefers https over http when a service lists both.
+func pickRDAPURL(urls []string) string {
+	for _, u := range urls {
+		if strings.HasPrefix(u, "https://") {
+			return u
+		}
+	}
+	return urls[0]
+}
+
+// rdapEntryMatch returns the match specificity of a bootstrap entry, or -1.
+func rdapEntryMatch(kind, entry, query string) int {
+	switch kind {
+	case "domain":
+		entry = strings.ToLower(strings.Trim(entry, "."))
+		q := strings.ToLower(query)
+		if q == entry || strings.HasSuffix(q, "."+entry) {
+			return len(entry)
+		}
+	case "ip":
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			return -1
+		}
+		if cidr.Contains(net.ParseIP(query)) {
+			ones, _ := cidr.Mask.Size()
+			return ones
+		}
+	case "asn":
+		n, _ := parseASN(query)
+		lo, hi, found := strings.Cut(entry, "-")
+		if !found {
+			hi = lo
+		}
+		l, err1 := strconv.ParseInt(lo, 10, 64)
+		h, err2 := strconv.ParseInt(hi, 10, 64)
+		if err1 == nil && err2 == nil && n >= l && n <= h {
+			// IANA ASN ranges do not overlap, so any match is the match.
+			return 0
+		}
+	}
+	return -1
+}
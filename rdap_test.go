@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRDAPServerFor(t *testing.T) {
+	bs := rdapBootstrap{Services: [][][]string{
+		{{"uk"}, {"https://rdap.nominet.uk/uk/"}},
+		{{"co.uk"}, {"http://rdap.example/co.uk/", "https://rdap.example/co.uk/"}},
+		{{"10.0.0.0/8"}, {"https://rdap.example/ten/"}},
+		{{"10.1.0.0/16"}, {"https://rdap.example/ten-one/"}},
+		{{"2001:db8::/32"}, {"https://rdap.example/v6/"}},
+		{{"1-1876", "1902-2042"}, {"https://rdap.example/arin/"}},
+		{{"64496-64511"}, {"https://rdap.example/doc/"}},
+	}}
+	tests := []struct {
+		kind, query, want string
+	}{
+		{"domain", "example.uk", "https://rdap.nominet.uk/uk/"},
+		{"domain", "shop.example.co.uk", "https://rdap.example/co.uk/"},
+		{"domain", "example.nl", ""},
+		{"ip", "10.2.3.4", "https://rdap.example/ten/"},
+		{"ip", "10.1.3.4", "https://rdap.example/ten-one/"},
+		{"ip", "2001:db8::1", "https://rdap.example/v6/"},
+		{"ip", "192.0.2.1", ""},
+		{"asn", "AS1900", ""},
+		{"asn", "AS1902", "https://rdap.example/arin/"},
+		{"asn", "64500", "https://rdap.example/doc/"},
+	}
+	for _, tt := range tests {
+		if got := rdapServerFor(bs, tt.kind, tt.query); got != tt.want {
+			t.Errorf("rdapServerFor(%s %s) = %q, want %q", tt.kind, tt.query, got, tt.want)
+		}
+	}
+}
+
+const rdapDomainJSON = `{
+  "ldhName": "EXAMPLE.COM.",
+  "handle": "2336799_DOMAIN_COM-VRSN",
+  "status": ["client transfer prohibited"],
+  "events": [
+    {"eventAction": "registration", "eventDate": "1995-08-14T04:00:00Z"},
+    {"eventAction": "expiration", "eventDate": "2030-08-13T04:00:00Z"},
+    {"eventAction": "last changed", "eventDate": "2024-08-14T07:01:34Z"}
+  ],
+  "nameservers": [{"ldhName": "A.IANA-SERVERS.NET"}, {"ldhName": "B.IANA-SERVERS.NET."}],
+  "secureDNS": {"delegationSigned": true},
+  "entities": [{
+    "handle": "376",
+    "roles": ["registrar"],
+    "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "RESERVED-Internet Assigned Numbers Authority"]]],
+    "entities": [{"roles": ["abuse"], "vcardArray": ["vcard", [["fn", {}, "text", "Abuse desk"]]]}]
+  }]
+}`
+
+func TestMapRDAP(t *testing.T) {
+	var r rdapResponse
+	if err := json.Unmarshal([]byte(rdapDomainJSON), &r); err != nil {
+		t.Fatal(err)
+	}
+	res := whoisResult{Kind: "domain"}
+	mapRDAP(&res, r)
+
+	if res.Domain != "example.com" || res.Handle != "2336799_DOMAIN_COM-VRSN" {
+		t.Errorf("domain/handle = %q/%q", res.Domain, res.Handle)
+	}
+	if res.Created != "1995-08-14T04:00:00Z" || res.Expires != "2030-08-13T04:00:00Z" || res.Updated != "2024-08-14T07:01:34Z" {
+		t.Errorf("dates = %q %q %q", res.Created, res.Expires, res.Updated)
+	}
+	if got := strings.Join(res.NameServers, ","); got != "a.iana-servers.net,b.iana-servers.net" {
+		t.Errorf("nameservers = %s", got)
+	}
+	if !res.DNSSEC {
+		t.Error("dnssec not set")
+	}
+	if res.Registrar != "RESERVED-Internet Assigned Numbers Authority" {
+		t.Errorf("registrar = %q", res.Registrar)
+	}
+	if len(res.Entities) != 2 || res.Entities[1].Name != "Abuse desk" {
+		t.Errorf("entities = %+v", res.Entities)
+	}
+
+	ip := whoisResult{Kind: "ip"}
+	mapRDAP(&ip, rdapResponse{StartAddress: "192.0.2.0", EndAddress: "192.0.2.255", Country: "NL"})
+	if ip.Range != "192.0.2.0 - 192.0.2.255" || ip.Country != "NL" {
+		t.Errorf("ip range/country = %q/%q", ip.Range, ip.Country)
+	}
+	asn := whoisResult{Kind: "asn"}
+	mapRDAP(&asn, rdapResponse{StartAutnum: 64496, EndAutnum: 64511})
+	if asn.Range != "AS64496 - AS64511" {
+		t.Errorf("asn range = %q", asn.Range)
+	}
+}
+
+// rdapTestServer serves a bootstrap file under /bootstrap/ that sends .com
+// to /com/ on the same server, where only example.com exists.
+func rdapTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/bootstrap/dns.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"services": [[["com"], [%q]]]}`, srv.URL+"/com/")
+	})
+	mux.HandleFunc("/com/domain/example.com", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rdap+json")
+		fmt.Fprint(w, rdapDomainJSON)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLookupRDAP(t *testing.T) {
+	srv := rdapTestServer(t)
+	o := options{rdapBootstrap: srv.URL + "/bootstrap/"}
+	ctx := context.Background()
+
+	res, err := lookupRDAP(ctx, "example.com", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "rdap" || res.Server != srv.URL+"/com/domain/example.com" || res.Domain != "example.com" {
+		t.Errorf("result = %+v", res)
+	}
+
+	_, err = lookupRDAP(ctx, "missing.com", o)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing.com: err = %v, want 404", err)
+	}
+	_, err = lookupRDAP(ctx, "example.nl", o)
+	if err != errNoRDAPService {
+		t.Errorf("example.nl: err = %v, want %v", err, errNoRDAPService)
+	}
+}
+
+// fakeWhois answers every WHOIS query on a local port with respond(query).
+func fakeWhois(t *testing.T, respond func(query string) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				q, _ := bufio.NewReader(conn).ReadString('\n')
+				fmt.Fprint(conn, respond(strings.TrimSpace(q)))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// missing.com is not in the RDAP server, so the lookup falls back to the
+// WHOIS chain: IANA for the TLD, then the registry it refers to.
+func TestLookupRegistrationWHOISFallbackDomain(t *testing.T) {
+	registry := fakeWhois(t, func(q string) string {
+		if q != "missing.com" {
+			return "No match for \"" + strings.ToUpper(q) + "\".\r\n"
+		}
+		return "   Domain Name: MISSING.COM\r\n" +
+			"   Registrar: Test Registrar B.V.\r\n" +
+			"   Creation Date: 2001-02-03T04:05:06Z\r\n" +
+			"   Registry Expiry Date: 2031-02-03T04:05:06Z\r\n" +
+			"   Domain Status: clientTransferProhibited https://icann.org/epp#clientTransferProhibited\r\n" +
+			"   Name Server: NS1.EXAMPLE.NET\r\n"
+	})
+	iana := fakeWhois(t, func(q string) string {
+		if q != "com" {
+			return "% no match\n"
+		}
+		return "domain: COM\nrefer: " + registry + "\n"
+	})
+	defer func(s string) { ianaWhoisServer = s }(ianaWhoisServer)
+	ianaWhoisServer = iana
+
+	srv := rdapTestServer(t)
+	o := options{rdapBootstrap: srv.URL + "/bootstrap/", whoisFollow: true, timeout: 2 * time.Second}
+	res, err := lookupRegistration(context.Background(), "missing.com", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "whois" || res.Kind != "domain" || res.Server != registry {
+		t.Errorf("source/kind/server = %q/%q/%q, want whois/domain/%s", res.Source, res.Kind, res.Server, registry)
+	}
+	if len(res.Chain) != 2 || res.Chain[0].Server != iana {
+		t.Fatalf("chain = %+v, want IANA and the registry", res.Chain)
+	}
+	if res.Registrar != "Test Registrar B.V." || res.ExpiresAt == nil || res.ExpiresAt.Year() != 2031 {
+		t.Errorf("registrar %q, expires %v (parse error %q)", res.Registrar, res.ExpiresAt, res.ParseError)
+	}
+}
+
+// The bootstrap has no ipv4.json, so RDAP fails for an IP as well.
+func TestLookupRegistrationWHOISFallback(t *testing.T) {
+	registry := fakeWhois(t, func(q string) string {
+		return "NetRange:       192.0.2.0 - 192.0.2.255\r\n" +
+			"NetName:        TEST-NET-1\r\n" +
+			"Organization:   Test Registry\r\n"
+	})
+	iana := fakeWhois(t, func(q string) string {
+		if q != "192.0.2.1" {
+			return "% no match\n"
+		}
+		return "inetnum: 192.0.0.0 - 192.255.255.255\nrefer: " + registry + "\n"
+	})
+	defer func(s string) { ianaWhoisServer = s }(ianaWhoisServer)
+	ianaWhoisServer = iana
+
+	srv := rdapTestServer(t)
+	o := options{rdapBootstrap: srv.URL + "/bootstrap/", whoisFollow: true, timeout: 2 * time.Second}
+	res, err := lookupRegistration(context.Background(), "192.0.2.1", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "whois" || res.Kind != "ip" || res.Server != registry {
+		t.Errorf("source/kind/server = %q/%q/%q, want whois/ip/%s", res.Source, res.Kind, res.Server, registry)
+	}
+	if len(res.Chain) != 2 || res.Chain[0].Server != iana {
+		t.Fatalf("chain = %+v, want IANA and the registry", res.Chain)
+	}
+	if !strings.Contains(res.Raw, "TEST-NET-1") || strings.Contains(res.Raw, "inetnum") {
+		t.Errorf("raw = %q, want only the registry response", res.Raw)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsRecord is one resource record in presentation format, split up so it
+// can be compared and serialized without carrying dns.RR values around.
+type dnsRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+func (r dnsRecord) String() string {
+	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s", r.Name, r.TTL, r.Type, r.Data)
+}
+
+// RR parses the record back into a dns.RR.
+func (r dnsRecord) RR() (dns.RR, error) {
+	return dns.NewRR(r.String())
+}
+
+func toDNSRecords(rrs []dns.RR) []dnsRecord {
+	var out []dnsRecord
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h == nil || h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		out = append(out, dnsRecord{
+			Name: h.Name,
+			Type: dns.TypeToString[h.Rrtype],
+			TTL:  h.Ttl,
+			Data: strings.TrimPrefix(rr.String(), h.String()),
+		})
+	}
+	return out
+}
+
+// queryResult is the answer (or error) for a single name/type question.
+type queryResult struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Records  []dnsRecord `json:"records,omitempty"`
+	NXDomain bool        `json:"nxdomain,omitempty"`
+	Error    string      `json:"error,omitempty"`
+
+	err error // Error as a value, for the exit code
+}
+
+func runQuery(ctx context.Context, client *dns.Client, resolver, name string, qtype uint16) queryResult {
+	q := queryResult{Name: dns.Fqdn(name), Type: dns.TypeToString[qtype]}
+	in, err := queryRecursive(ctx, client, resolver, name, qtype)
+	if err = answerError(in, err); err != nil {
+		q.Error, q.err = err.Error(), err
+		return q
+	}
+	q.NXDomain = in.Rcode == dns.RcodeNameError
+	q.Records = toDNSRecords(append(in.Answer, in.Extra...))
+	return q
+}
+
+// RRs parses the stored records; records that fail to parse are skipped.
+func (q queryResult) RRs() []dns.RR {
+	var out []dns.RR
+	for _, r := range q.Records {
+		if rr, err := r.RR(); err == nil {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// dnsReport is everything a run collected about one domain. It is what -json
+// prints, and the text output is rendered from it as well.
+type dnsReport struct {
+	Domain     string        `json:"domain"`
+	Resolver   string        `json:"resolver"`
+	Time       time.Time     `json:"time"`
+	Queries    []queryResult `json:"queries,omitempty"`
+	SRV        []srvResult   `json:"srv,omitempty"`
+	Mail       *mailReport   `json:"mail,omitempty"`
+	IPs        []ipInfo      `json:"ips,omitempty"`
+	Whois      *whoisResult  `json:"whois,omitempty"`
+	Subdomains []string      `json:"subdomains,omitempty"`
+
+	// SubdomainSources holds, per name, the sources that had it; only
+	// with more than one source. SubdomainErrors holds failed sources
+	// when others did answer.
+	SubdomainSources map[string][]string `json:"subdomain_sources,omitempty"`
+	SubdomainErrors  map[string]string   `json:"subdomain_errors,omitempty"`
+
+	Inventory  []subdomainInfo   `json:"subdomain_inventory,omitempty"`
+	Bruteforce *bruteReport      `json:"bruteforce,omitempty"`
+	Diversity  *diversityReport  `json:"diversity,omitempty"`
+	Delegation *delegationReport `json:"delegation,omitempty"`
+	Lint       []lintFinding     `json:"lint,omitempty"`
+	Takeover   *takeoverReport   `json:"takeover,omitempty"`
+	Certs      *certReport       `json:"certificates,omitempty"`
+
+	// SRVErrors holds the catalogue labels whose lookup failed.
+	SRVErrors map[string]string `json:"srv_errors,omitempty"`
+	srv       srvLookup
+
+	// Errors holds failures of whole sections (whois, subs), keyed by section.
+	Errors map[string]string `json:"errors,omitempty"`
+	errs   map[string]error
+}
+
+// allDNSTypes are the types queried for the apex with -n.
+var allDNSTypes = []uint16{
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeCNAME,
+	dns.TypeMX,
+	dns.TypeNS,
+	dns.TypeTXT,
+	dns.TypeSOA,
+	dns.TypeCAA,
+}
+
+// collectDNS runs the -n queries: all apex types, the SRV catalogue and the
+// mail checks, plus IP ownership when an enricher is configured.
+func collectDNS(ctx context.Context, client *dns.Client, resolver, domain string, srvCatalogue []srvService, enricher ipEnricher) *dnsReport {
+	r := &dnsReport{Domain: domain, Resolver: resolver, Time: time.Now().UTC()}
+	for _, qtype := range allDNSTypes {
+		r.Queries = append(r.Queries, runQuery(ctx, client, resolver, domain, qtype))
+	}
+	r.setSRV(collectSRV(ctx, client, resolver, domain, srvCatalogue))
+	mail := collectMail(ctx, client, resolver, domain)
+	r.Mail = &mail
+
+	r.IPs = enrichIPs(ctx, enricher, r.addresses())
+	return r
+}
+
+// collectInfra only collects the NS and MX sets, for sections that need
+// them without a full -n run.
+func collectInfra(ctx context.Context, client *dns.Client, resolver, domain string) *dnsReport {
+	r := &dnsReport{Domain: domain, Resolver: resolver, Time: time.Now().UTC()}
+	r.Queries = append(r.Queries, runQuery(ctx, client, resolver, domain, dns.TypeNS))
+	mail := mailReport{}
+	mx, err := collectMXTargets(ctx, client, resolver, domain)
+	if err != nil {
+		mail.Errors = map[string]string{"MX": err.Error()}
+	}
+	mail.MX = mx
+	r.Mail = &mail
+	return r
+}
+
+// setSRV stores the outcome of collectSRV.
+func (r *dnsReport) setSRV(l srvLookup) {
+	r.SRV, r.srv, r.SRVErrors = l.Results, l, nil
+	for label, err := range l.Failed {
+		if r.SRVErrors == nil {
+			r.SRVErrors = map[string]string{}
+		}
+		r.SRVErrors[label] = err.Error()
+	}
+}
+
+// addresses returns the A/AAAA and MX addresses in the report.
+func (r *dnsReport) addresses() []string {
+	var ips []string
+	for _, q := range r.Queries {
+		if q.Type == "A" || q.Type == "AAAA" {
+			ips = append(ips, extractIPs(q.RRs())...)
+		}
+	}
+	if r.Mail != nil {
+		for _, mx := range r.Mail.MX {
+			ips = append(ips, mx.IPs...)
+		}
+	}
+	return ips
+}
+
+// ipOwner returns the enrichment for ip, if any.
+func (r *dnsReport) ipOwner(ip string) (ipInfo, bool) {
+	for _, info := range r.IPs {
+		if info.IP == ip {
+			return info, true
+		}
+	}
+	return ipInfo{}, false
+}
+
+func printQueryResult(q queryResult) {
+	if q.Error != "" {
+		fmt.Printf("error: %s\n", q.Error)
+		return
+	}
+	if len(q.Records) == 0 {
+		fmt.Println("(geen records)")
+		return
+	}
+	for _, rec := range q.Records {
+		fmt.Println(rec.String())
+	}
+}
+
+// printIPOwners prints the enrichment for ips, indented under the record
+// output they belong to.
+func printIPOwners(r *dnsReport, ips []string, indent string) {
+	for _, ip := range ips {
+		if info, ok := r.ipOwner(ip); ok {
+			fmt.Printf("%s%s: %s\n", indent, ip, info)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// runJSON collects the selected sections into one report and writes it to
+// out; stdout receives the zone file for -zone-out -. The exit code is
+// derived from the report, as in the text output.
+func runJSON(ctx context.Context, client *dns.Client, resolver, domain string, o options, srvCatalogue []srvService, enricher ipEnricher, out, stdout io.Writer) int {
+	r := buildReport(ctx, client, resolver, domain, o, srvCatalogue, enricher)
+	if err := writeJSON(out, r); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFindings
+	}
+	var st runStatus
+	st.reportChecks(r, o.warnDays)
+	if o.zoneOut != "" {
+		if _, err := exportZone(ctx, client, resolver, r, o.zoneOut, stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			st.fail(exitFindings)
+		}
+	}
+	return st.exitCode(o.strict)
+}
+
+// buildReport collects the sections selected in o for one domain.
+func buildReport(ctx context.Context, client *dns.Client, resolver, domain string, o options, srvCatalogue []srvService, enricher ipEnricher) *dnsReport {
+	r := &dnsReport{Domain: domain, Resolver: resolver, Time: time.Now().UTC()}
+	if o.n {
+		r = collectDNS(ctx, client, resolver, domain, srvCatalogue, enricher)
+	}
+	if qtypes := recordOnlyTypes(o); len(qtypes) > 0 {
+		for _, qtype := range qtypes {
+			r.Queries = append(r.Queries, runQuery(ctx, client, resolver, domain, qtype))
+		}
+		r.IPs = enrichIPs(ctx, enricher, r.addresses())
+	}
+	if o.srv {
+		r.setSRV(collectSRV(ctx, client, resolver, domain, srvCatalogue))
+	}
+
+	if o.diversity {
+		infra := r
+		if !o.n {
+			infra = collectInfra(ctx, client, resolver, domain)
+		}
+		r.Diversity = analyseDiversity(ctx, client, resolver, infra, enricher)
+	}
+
+	errs := map[string]error{}
+	if o.delegation {
+		rep, err := checkDelegation(ctx, client, resolver, domain)
+		if err != nil {
+			errs["delegation"] = err
+		}
+		r.Delegation = rep
+	}
+	if o.whois {
+		res, err := lookupRegistration(ctx, domain, o)
+		if err != nil {
+			errs["whois"] = err
+		} else {
+			r.Whois = &res
+		}
+	}
+	if o.subs {
+		res, err := fetchSubdomains(ctx, domain, o.sources)
+		if err != nil {
+			errs["subs"] = err
+		} else {
+			r.Subdomains = res.Names
+			if len(o.sources) > 1 {
+				r.SubdomainSources = res.Sources
+			}
+			if len(res.Errors) > 0 {
+				r.SubdomainErrors = res.Errors
+			}
+			if o.certs {
+				r.Certs = analyseCerts(ctx, client, resolver, res.Certs, o.certWarnDays, time.Now())
+			}
+			if o.subsResolve {
+				r.Inventory = classifySubdomains(ctx, client, resolver, domain, res.Names, o.subsWorkers, o.subsHTTP)
+			}
+		}
+	}
+	if o.brute {
+		words, _ := bruteWords(o)
+		r.Bruteforce = bruteForce(ctx, client, resolver, domain, words, o.bruteWorkers, o.bruteDepth)
+	}
+	if o.lint {
+		rules, _ := o.lintSelection().rules()
+		r.Lint = lintLive(ctx, client, resolver, r, rules)
+	}
+	if o.takeover {
+		db, zoneRRs, _ := takeoverInputs(o, domain)
+		names := takeoverNames(collectZoneRecords(ctx, client, resolver, r), zoneRRs, r.Subdomains, r.Bruteforce)
+		r.Takeover = checkTakeover(ctx, client, resolver, names, db, o.subsWorkers)
+	}
+	if len(errs) > 0 {
+		r.Errors, r.errs = map[string]string{}, errs
+		for k, err := range errs {
+			r.Errors[k] = err.Error()
+		}
+	}
+	return r
+}
+
+// failures lists the errors in a report: failed queries and sections, and
+// the SRV catalogue when every lookup failed. NXDOMAIN is an answer, not a
+// failure.
+func (r *dnsReport) failures() []string {
+	var out []string
+	for _, q := range r.Queries {
+		if q.Error != "" {
+			out = append(out, q.Type+": "+q.Error)
+		}
+	}
+	if r.Mail != nil {
+		for _, k := range sortedKeys(r.Mail.Errors) {
+			out = append(out, k+": "+r.Mail.Errors[k])
+		}
+	}
+	for _, k := range sortedKeys(r.Errors) {
+		out = append(out, k+": "+r.Errors[k])
+	}
+	if err := r.srv.err(); err != nil {
+		out = append(out, "SRV: "+err.Error())
+	}
+	return out
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// snapshot is the comparable DNS state of one domain: the records of a -n run,
+// the mail checks and the WHOIS fields that matter when a domain is hijacked
+// or moved. TTLs are stored but never compared, because a recursive resolver
+// counts them down between runs.
+type snapshot struct {
+	Domain   string            `json:"domain"`
+	Resolver string            `json:"resolver"`
+	Time     time.Time         `json:"time"`
+	Records  []dnsRecord       `json:"records"`
+	Mail     *snapshotMail     `json:"mail,omitempty"`
+	Whois    *snapshotWhois    `json:"whois,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+type snapshotMail struct {
+	SPF    string            `json:"spf,omitempty"`
+	DMARC  string            `json:"dmarc,omitempty"`
+	DKIM   map[string]string `json:"dkim,omitempty"`
+	MTASTS string            `json:"mta_sts,omitempty"`
+	TLSRPT string            `json:"tls_rpt,omitempty"`
+}
+
+type snapshotWhois struct {
+	Registrar   string   `json:"registrar,omitempty"`
+	Status      []string `json:"status,omitempty"`
+	NameServers []string `json:"nameservers,omitempty"`
+	Expires     string   `json:"expires,omitempty"`
+	DNSSEC      bool     `json:"dnssec,omitempty"`
+}
+
+// makeSnapshot reduces a report to its comparable state. Only records of the
+// queried type (and CNAMEs on the way there) are kept; the additional section
+// differs between resolvers and would only add noise.
+func makeSnapshot(r *dnsReport) *snapshot {
+	s := &snapshot{Domain: r.Domain, Resolver: r.Resolver, Time: r.Time}
+	errs := map[string]string{}
+
+	queries := append([]queryResult{}, r.Queries...)
+	for _, res := range r.SRV {
+		queries = append(queries, res.queryResult)
+	}
+	seen := map[string]bool{}
+	for _, q := range queries {
+		if q.Error != "" {
+			errs[strings.ToLower(q.Name)+" "+q.Type] = q.Error
+			continue
+		}
+		for _, rec := range q.Records {
+			if rec.Type != q.Type && rec.Type != "CNAME" {
+				continue
+			}
+			rec.Name = strings.ToLower(rec.Name)
+			rec.Data = strings.TrimSpace(rec.Data)
+			if k := recordKey(rec); !seen[k] {
+				seen[k] = true
+				s.Records = append(s.Records, rec)
+			}
+		}
+	}
+	sort.Slice(s.Records, func(i, j int) bool { return recordKey(s.Records[i]) < recordKey(s.Records[j]) })
+
+	if m := r.Mail; m != nil {
+		s.Mail = &snapshotMail{SPF: m.SPF, DMARC: m.DMARC, MTASTS: m.MTASTS, TLSRPT: m.TLSRPT}
+		for _, k := range m.DKIM {
+			if s.Mail.DKIM == nil {
+				s.Mail.DKIM = map[string]string{}
+			}
+			s.Mail.DKIM[k.Selector] = k.Record
+		}
+		for check, err := range m.Errors {
+			errs["mail "+check] = err
+		}
+	}
+
+	if w := r.Whois; w != nil {
+		sw := &snapshotWhois{Registrar: w.Registrar, DNSSEC: w.DNSSEC, Expires: w.Expires}
+		if w.ExpiresAt != nil {
+			sw.Expires = w.ExpiresAt.Format("2006-01-02")
+		}
+		for _, st := range w.Status {
+			sw.Status = append(sw.Status, normalizeEPPStatus(st))
+		}
+		for _, ns := range w.NameServers {
+			sw.NameServers = append(sw.NameServers, strings.ToLower(strings.TrimSuffix(ns, ".")))
+		}
+		sort.Strings(sw.Status)
+		sort.Strings(sw.NameServers)
+		s.Whois = sw
+	}
+	for label, v := range r.SRVErrors {
+		errs[strings.ToLower(dns.Fqdn(label+"."+r.Domain))+" SRV"] = v
+	}
+	for k, v := range r.Errors {
+		errs[k] = v
+	}
+	if len(errs) > 0 {
+		s.Errors = errs
+	}
+	return s
+}
+
+func recordKey(r dnsRecord) string {
+	return r.Name + " " + r.Type + " " + r.Data
+}
+
+// snapshotChange is one difference between two snapshots.
+type snapshotChange struct {
+	Kind    string `json:"kind"`    // added, removed or changed
+	Section string `json:"section"` // records, mail or whois
+	Key     string `json:"key"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+}
+
+func (c snapshotChange) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s %s", c.Key, c.New)
+	case "removed":
+		return fmt.Sprintf("- %s %s", c.Key, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Key, orNone(c.Old), orNone(c.New))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(geen)"
+	}
+	return s
+}
+
+// diffSnapshots compares two snapshots of the same domain. Record sets that
+// could not be queried in either snapshot are skipped and returned as
+// warnings, so a timeout does not show up as "all records removed".
+func diffSnapshots(old, cur *snapshot) (changes []snapshotChange, warnings []string) {
+	skip := map[string]bool{}
+	for _, s := range []*snapshot{old, cur} {
+		for _, k := range sortedKeys(s.Errors) {
+			skip[k] = true
+			warnings = append(warnings, fmt.Sprintf("%s: %s (niet vergeleken)", k, s.Errors[k]))
+		}
+	}
+
+	oldSet := map[string]dnsRecord{}
+	for _, r := range old.Records {
+		oldSet[recordKey(r)] = r
+	}
+	curSet := map[string]dnsRecord{}
+	for _, r := range cur.Records {
+		curSet[recordKey(r)] = r
+	}
+	// Differences are grouped per RRset: an RRset that lost and gained
+	// records is reported once as changed.
+	removed := map[string][]string{}
+	added := map[string][]string{}
+	for _, k := range sortedKeys(oldSet) {
+		r := oldSet[k]
+		if _, ok := curSet[k]; !ok && !skip[r.Name+" "+r.Type] {
+			removed[r.Name+" "+r.Type] = append(removed[r.Name+" "+r.Type], r.Data)
+		}
+	}
+	for _, k := range sortedKeys(curSet) {
+		r := curSet[k]
+		if _, ok := oldSet[k]; !ok && !skip[r.Name+" "+r.Type] {
+			added[r.Name+" "+r.Type] = append(added[r.Name+" "+r.Type], r.Data)
+		}
+	}
+	rrsets := map[string]bool{}
+	for k := range removed {
+		rrsets[k] = true
+	}
+	for k := range added {
+		rrsets[k] = true
+	}
+	for _, k := range sortedKeys(rrsets) {
+		c := snapshotChange{Kind: "changed", Section: "records", Key: k, Old: strings.Join(removed[k], ", "), New: strings.Join(added[k], ", ")}
+		switch {
+		case c.Old == "":
+			c.Kind = "added"
+		case c.New == "":
+			c.Kind = "removed"
+		}
+		changes = append(changes, c)
+	}
+
+	if old.Mail != nil && cur.Mail != nil {
+		changes = append(changes, diffMail(old.Mail, cur.Mail, skip)...)
+	}
+	if old.Whois != nil && cur.Whois != nil && !skip["whois"] {
+		changes = append(changes, diffWhois(old.Whois, cur.Whois)...)
+	}
+	return changes, warnings
+}
+
+func diffMail(old, cur *snapshotMail, skip map[string]bool) []snapshotChange {
+	var out []snapshotChange
+	field := func(name, a, b string) {
+		if a != b && !skip["mail "+name] {
+			out = append(out, snapshotChange{Kind: "changed", Section: "mail", Key: "mail " + name, Old: a, New: b})
+		}
+	}
+	field("SPF", old.SPF, cur.SPF)
+	field("DMARC", old.DMARC, cur.DMARC)
+	field("MTA-STS", old.MTASTS, cur.MTASTS)
+	field("TLS-RPT", old.TLSRPT, cur.TLSRPT)
+
+	selectors := map[string]bool{}
+	for s := range old.DKIM {
+		selectors[s] = true
+	}
+	for s := range cur.DKIM {
+		selectors[s] = true
+	}
+	for _, s := range sortedKeys(selectors) {
+		field("DKIM "+s, old.DKIM[s], cur.DKIM[s])
+	}
+	return out
+}
+
+func diffWhois(old, cur *snapshotWhois) []snapshotChange {
+	var out []snapshotChange
+	field := func(name, a, b string) {
+		if !strings.EqualFold(a, b) {
+			out = append(out, snapshotChange{Kind: "changed", Section: "whois", Key: "whois " + name, Old: a, New: b})
+		}
+	}
+	field("registrar", old.Registrar, cur.Registrar)
+	field("status", strings.Join(old.Status, ", "), strings.Join(cur.Status, ", "))
+	field("nameservers", strings.Join(old.NameServers, ", "), strings.Join(cur.NameServers, ", "))
+	field("expires", old.Expires, cur.Expires)
+	field("dnssec", fmt.Sprint(old.DNSSEC), fmt.Sprint(cur.DNSSEC))
+	return out
+}
+
+// takeSnapshot runs a -n and WHOIS collection for domain.
+func takeSnapshot(ctx context.Context, client *dns.Client, resolver, domain string, o options, srvCatalogue []srvService) *snapshot {
+	o.n = true
+	return makeSnapshot(buildReport(ctx, client, resolver, domain, o, srvCatalogue, nil))
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// runSnapshotCmd implements "ultradns snapshot". Exit codes: 0 snapshot
+// complete, 1 written but some queries failed, 2 usage or write error.
+func runSnapshotCmd(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	o := options{whoisFollow: true, rdapBootstrap: defaultRDAPBootstrap}
+	var out string
+	fs.StringVar(&o.domain, "d", "", "Domein")
+	fs.StringVar(&out, "out", "-", "Schrijf de snapshot naar dit bestand (- voor stdout)")
+	fs.BoolVar(&o.whois, "whois", true, "Neem WHOIS/RDAP velden op (registrar, status, nameservers, expiratie)")
+	fs.BoolVar(&o.noRDAP, "no-rdap", false, "Sla RDAP over en gebruik alleen WHOIS (poort 43)")
+	fs.StringVar(&o.rdapServer, "rdap-server", "", "Vaste RDAP base URL (slaat IANA bootstrap over)")
+	fs.StringVar(&o.rdapBootstrap, "rdap-bootstrap", defaultRDAPBootstrap, "Base URL van de IANA RDAP bootstrap bestanden")
+	fs.StringVar(&o.resolver, "r", "", "Resolver (ip:port). Default: systeem resolvers of 8.8.8.8:53")
+	fs.DurationVar(&o.timeout, "timeout", 5*time.Second, "Timeout per query")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns snapshot -d <domein> [-out snapshot.json]\n\n")
+		fmt.Fprintf(os.Stderr, "Legt alle DNS records, mail checks en WHOIS kernvelden vast om later te vergelijken met 'ultradns diff'.\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = ok, 1 = geschreven maar met mislukte queries, 2 = fout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if o.domain == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	domain := normalizeDomain(o.domain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	resolver := pickResolver(o.resolver)
+	client := &dns.Client{Timeout: o.timeout}
+	s := takeSnapshot(ctx, client, resolver, domain, o, defaultSRVCatalogue)
+
+	w := io.Writer(os.Stdout)
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeJSON(w, s); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	if len(s.Errors) > 0 {
+		for _, k := range sortedKeys(s.Errors) {
+			fmt.Fprintf(os.Stderr, "[!] %s: %s\n", k, s.Errors[k])
+		}
+		return exitFindings
+	}
+	return exitOK
+}
+
+// runDiffCmd implements "ultradns diff". Exit codes follow diff(1): 0 no
+// changes, 1 changes found, 2 error.
+func runDiffCmd(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var asJSON bool
+	fs.BoolVar(&asJSON, "json", false, "Output als JSON")
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns diff [-json] <oud.json> <nieuw.json>\n\n")
+		fmt.Fprintf(os.Stderr, "Vergelijkt twee snapshots (toegevoegde, verwijderde en gewijzigde records; TTL's worden genegeerd).\n")
+		fmt.Fprintf(os.Stderr, "Exit codes: 0 = geen wijzigingen, 1 = wijzigingen, 2 = fout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	old, err := readSnapshot(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	cur, err := readSnapshot(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	if !strings.EqualFold(old.Domain, cur.Domain) {
+		fmt.Fprintf(os.Stderr, "error: snapshots zijn van verschillende domeinen (%s en %s)\n", old.Domain, cur.Domain)
+		return exitUsage
+	}
+
+	changes, warnings := diffSnapshots(old, cur)
+	if asJSON {
+		if err := writeJSON(os.Stdout, map[string]any{
+			"domain":   cur.Domain,
+			"old":      old.Time,
+			"new":      cur.Time,
+			"changes":  changes,
+			"warnings": warnings,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	} else {
+		fmt.Printf("Domain: %s | %s -> %s\n\n", cur.Domain, old.Time.Format(time.RFC3339), cur.Time.Format(time.RFC3339))
+		for _, w := range warnings {
+			fmt.Printf("[!] %s\n", w)
+		}
+		if len(changes) == 0 {
+			fmt.Println("Geen wijzigingen")
+		}
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+
+	if len(changes) > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
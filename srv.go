@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/miekg/dns"
+)
+
+type srvService struct {
+	Label       string
+	Description string
+}
+
+var defaultSRVCatalogue = []srvService{
+	{"_sip._tcp", "SIP"}, {"_sip._udp", "SIP"}, {"_sips._tcp", "SIP over TLS"},
+	{"_submission._tcp", "mail submission"}, {"_smtps._tcp", "SMTP over TLS"},
+	{"_imap._tcp", "IMAP"}, {"_imaps._tcp", "IMAP over TLS"}, {"_pop3._tcp", "POP3"}, {"_pop3s._tcp", "POP3 over TLS"},
+	{"_xmpp-client._tcp", "XMPP client"}, {"_xmpp-server._tcp", "XMPP server"},
+	{"_autodiscover._tcp", "Exchange autodiscover"},
+	{"_caldav._tcp", "CalDAV"}, {"_carddav._tcp", "CardDAV"},
+	{"_ldap._tcp", "LDAP"},
+	{"_kerberos._udp", "Kerberos"}, {"_kerberos._tcp", "Kerberos"},
+	{"_ntp._udp", "NTP"},
+}
+
+// loadSRVCatalogue builds the list of SRV labels to probe. A catalogue file
+// replaces the built-in list; extra labels from flags are always appended.
+// File format: one label per line, optionally followed by a description;
+// empty lines and lines starting with '#' are ignored.
+func loadSRVCatalogue(path string, extra []string) ([]srvService, error) {
+	catalogue := defaultSRVCatalogue
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		catalogue = nil
+		sc := bufio.NewScanner(f)
+		lineNo := 0
+		for sc.Scan() {
+			lineNo++
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			// The description follows the label after a space or a tab.
+			label, desc := line, ""
+			if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+				label, desc = line[:i], line[i:]
+			}
+			if !strings.HasPrefix(label, "_") {
+				return nil, fmt.Errorf("%s:%d: ongeldig SRV label %q (verwacht bijv. _service._tcp)", path, lineNo, label)
+			}
+			catalogue = append(catalogue, srvService{Label: label, Description: strings.TrimSpace(desc)})
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]bool{}
+	out := make([]srvService, 0, len(catalogue)+len(extra))
+	for _, s := range catalogue {
+		s.Label = strings.ToLower(strings.Trim(s.Label, "."))
+		if !seen[s.Label] {
+			seen[s.Label] = true
+			out = append(out, s)
+		}
+	}
+	for _, l := range extra {
+		l = strings.ToLower(strings.Trim(strings.TrimSpace(l), "."))
+		if l == "" || seen[l] {
+			continue
+		}
+		if !strings.HasPrefix(l, "_") {
+			return nil, fmt.Errorf("ongeldig SRV label %q (verwacht bijv. _service._tcp)", l)
+		}
+		seen[l] = true
+		out = append(out, srvService{Label: l})
+	}
+	return out, nil
+}
+
+// srvResult is a catalogue entry that has SRV records.
+type srvResult struct {
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+	queryResult
+}
+
+// srvLookup is the outcome of collectSRV: the labels with records and the
+// labels whose lookup failed.
+type srvLookup struct {
+	Results []srvResult
+	Failed  map[string]error // by label
+	Queried int
+}
+
+// collectSRV queries every catalogue label and keeps those with at least one
+// SRV record at the queried name.
+func collectSRV(ctx context.Context, client *dns.Client, resolver, domain string, catalogue []srvService) srvLookup {
+	l := srvLookup{Queried: len(catalogue)}
+	for _, svc := range catalogue {
+		q := runQuery(ctx, client, resolver, svc.Label+"."+domain, dns.TypeSRV)
+		if q.Error != "" {
+			if l.Failed == nil {
+				l.Failed = map[string]error{}
+			}
+			l.Failed[svc.Label] = q.err
+			continue
+		}
+		if len(srvRecords(q)) == 0 {
+			continue
+		}
+		l.Results = append(l.Results, srvResult{Label: svc.Label, Description: svc.Description, queryResult: q})
+	}
+	return l
+}
+
+// err returns an error when every lookup failed: then the resolver is the
+// problem, not a label. A few failed labels among many are warnings.
+func (l srvLookup) err() error {
+	if l.Queried == 0 || len(l.Failed) < l.Queried {
+		return nil
+	}
+	labels := sortedKeys(l.Failed)
+	return fmt.Errorf("alle %d SRV lookups mislukt, o.a. %s: %w", l.Queried, labels[0], l.Failed[labels[0]])
+}
+
+func srvRecords(q queryResult) []*dns.SRV {
+	var srvs []*dns.SRV
+	for _, rr := range q.RRs() {
+		if v, ok := rr.(*dns.SRV); ok && strings.EqualFold(v.Hdr.Name, q.Name) {
+			srvs = append(srvs, v)
+		}
+	}
+	return srvs
+}
+
+// runCommonSRV prints the catalogue services found for domain and the
+// failed lookups, and returns the lookup outcome.
+func runCommonSRV(ctx context.Context, client *dns.Client, resolver, domain string, catalogue []srvService) srvLookup {
+	l := collectSRV(ctx, client, resolver, domain, catalogue)
+	printSRVResults(ctx, client, resolver, l.Results)
+	printSRVErrors(l.Failed)
+	return l
+}
+
+// printSRVErrors prints the labels whose lookup failed.
+func printSRVErrors(failed map[string]error) {
+	for _, label := range sortedKeys(failed) {
+		fmt.Printf("[!] %s: %v\n", label, failed[label])
+	}
+}
+
+func printSRVResults(ctx context.Context, client *dns.Client, resolver string, results []srvResult) {
+	for _, res := range results {
+		qname := strings.TrimSuffix(res.Name, ".")
+		if res.Description != "" {
+			fmt.Printf("  %s (%s)\n", qname, res.Description)
+		} else {
+			fmt.Printf("  %s\n", qname)
+		}
+
+		srvs := srvRecords(res.queryResult)
+		// RFC 2782: a single record with target "." means the service is
+		// decidedly not available at this domain.
+		if len(srvs) == 1 && srvs[0].Target == "." {
+			fmt.Printf("    service niet beschikbaar (target \".\")\n")
+			continue
+		}
+
+		printSRVOrdering(ctx, client, resolver, srvs)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("(geen SRV records gevonden voor bekende services)")
+	}
+}
+
+// printSRVOrdering prints the targets in the order a client would try them:
+// lowest priority first, and within one priority weighted by share.
+func printSRVOrdering(ctx context.Context, client *dns.Client, resolver string, srvs []*dns.SRV) {
+	sort.SliceStable(srvs, func(i, j int) bool {
+		if srvs[i].Priority != srvs[j].Priority {
+			return srvs[i].Priority < srvs[j].Priority
+		}
+		return srvs[i].Weight > srvs[j].Weight
+	})
+
+	first := true
+	for i := 0; i < len(srvs); {
+		j := i
+		var total int
+		for j < len(srvs) && srvs[j].Priority == srvs[i].Priority {
+			total += int(srvs[j].Weight)
+			j++
+		}
+		group := srvs[i:j]
+
+		role := "primair"
+		if !first {
+			role = "fallback"
+		}
+		first = false
+		fmt.Printf("    prioriteit %d (%s, %d target(s)):\n", group[0].Priority, role, len(group))
+
+		for _, s := range group {
+			share := 100.0 / float64(len(group))
+			if total > 0 {
+				share = float64(s.Weight) * 100 / float64(total)
+			}
+			target := strings.TrimSuffix(s.Target, ".")
+			fmt.Printf("      - %s:%d gewicht %d (~%.0f%% van het verkeer)\n", target, s.Port, s.Weight, share)
+
+			if s.Target == "." {
+				fmt.Printf("        [!] target \".\" naast andere records: service niet beschikbaar via dit record\n")
+				continue
+			}
+			cname, _ := queryType(ctx, client, resolver, target, dns.TypeCNAME)
+			for _, rr := range cname {
+				if c, ok := rr.(*dns.CNAME); ok {
+					fmt.Printf("        [!] target is een CNAME naar %s (niet toegestaan volgens RFC 2782)\n", strings.TrimSuffix(c.Target, "."))
+					break
+				}
+			}
+			a, _ := queryType(ctx, client, resolver, target, dns.TypeA)
+			aaaa, _ := queryType(ctx, client, resolver, target, dns.TypeAAAA)
+			ips := append(extractIPs(a), extractIPs(aaaa)...)
+			if len(ips) == 0 {
+				fmt.Printf("        resolve: geen A/AAAA\n")
+			} else {
+				fmt.Printf("        resolve: %s\n", strings.Join(ips, ", "))
+			}
+		}
+		if total == 0 && len(group) > 1 {
+			fmt.Printf("      (alle gewichten 0: clients kiezen willekeurig binnen deze prioriteit)\n")
+		}
+		i = j
+	}
+}
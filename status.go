@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Exit codes of a regular run (ultradns -d ...). The subcommands use
+// exitOK, exitFindings and exitUsage for clean, findings and errors.
+const (
+	exitOK          = 0
+	exitFindings    = 1 // a check failed: CAA, -warn-days, lint errors, takeover, CT certificates against CAA, zone export; with -strict also any warning
+	exitUsage       = 2 // invalid flags or input
+	exitNXDomain    = 3 // the domain does not exist
+	exitServFail    = 4 // the resolver answered SERVFAIL, REFUSED or another error rcode, or the query failed otherwise
+	exitTimeout     = 5 // queries timed out
+	exitUnreachable = 6 // the resolver could not be reached
+	exitWHOIS       = 7 // the WHOIS/RDAP lookup failed
+	exitCT          = 8 // the certificate transparency lookup failed
+)
+
+// exitPriority decides which code wins when a run hits several problems:
+// the most fundamental one, since it usually explains the rest.
+var exitPriority = []int{exitUnreachable, exitTimeout, exitServFail, exitNXDomain, exitWHOIS, exitCT, exitFindings}
+
+func exitRank(code int) int {
+	for i, c := range exitPriority {
+		if c == code {
+			return len(exitPriority) - i
+		}
+	}
+	return 0
+}
+
+// rcodeError is a response with an error rcode. NXDOMAIN is an answer, not
+// an error, so it never ends up here.
+type rcodeError int
+
+func (e rcodeError) Error() string {
+	return "dns rcode " + dns.RcodeToString[int(e)]
+}
+
+// answerError turns an error rcode in a response into an error.
+func answerError(in *dns.Msg, err error) error {
+	if err == nil && in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return rcodeError(in.Rcode)
+	}
+	return err
+}
+
+// classifyError maps a query error to an exit code. Reports keep errors
+// as text for -json and snapshots, so they carry the error value next to
+// it; an error that is neither a timeout nor a network error (or only
+// known as text) is a failed query, exitServFail.
+func classifyError(err error) int {
+	var rc rcodeError
+	var ne net.Error
+	var op *net.OpError
+	switch {
+	case errors.As(err, &rc):
+		return exitServFail
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled),
+		errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return exitTimeout
+	case errors.As(err, &op):
+		return exitUnreachable
+	}
+	return exitServFail
+}
+
+// runStatus collects the outcome of a run: the winning exit code and the
+// number of warnings (the [!] lines).
+type runStatus struct {
+	code     int
+	warnings int
+}
+
+func (s *runStatus) fail(code int) {
+	if exitRank(code) > exitRank(s.code) {
+		s.code = code
+	}
+}
+
+func (s *runStatus) failErr(err error) {
+	s.fail(classifyError(err))
+}
+
+func (s *runStatus) warn(n int) {
+	s.warnings += n
+}
+
+// query records a query result for domain: its error, or NXDOMAIN when the
+// domain itself does not exist.
+func (s *runStatus) query(domain string, q queryResult) {
+	switch {
+	case q.Error != "":
+		s.failErr(q.err)
+	case q.NXDomain && strings.EqualFold(q.Name, dns.Fqdn(domain)):
+		s.fail(exitNXDomain)
+	}
+}
+
+// report records everything in r: query, mail and section errors, and the
+// findings of the mail syntax, diversity, delegation, lint, takeover and
+// certificate checks. Failed SRV catalogue lookups are warnings unless all
+// of them failed.
+func (s *runStatus) report(r *dnsReport) {
+	for _, q := range r.Queries {
+		s.query(r.Domain, q)
+	}
+	if r.Mail != nil {
+		for _, k := range sortedKeys(r.Mail.Errors) {
+			s.failErr(r.Mail.errs[k])
+		}
+		s.warn(len(mailFindings(*r.Mail)))
+	}
+	if err := r.srv.err(); err != nil {
+		s.failErr(err)
+	} else {
+		s.warn(len(r.SRVErrors))
+	}
+	for section := range r.Errors {
+		switch section {
+		case "whois":
+			s.fail(exitWHOIS)
+		case "subs":
+			s.fail(exitCT)
+		default:
+			s.failErr(r.errs[section])
+		}
+	}
+	s.warn(len(r.SubdomainErrors))
+	s.inventory(r.Inventory)
+	if r.Certs != nil {
+		s.certs(r.Certs)
+	}
+	if r.Bruteforce != nil {
+		s.brute(r.Bruteforce)
+	}
+	if r.Diversity != nil {
+		s.warn(len(r.Diversity.Findings))
+	}
+	if r.Delegation != nil {
+		s.warn(len(r.Delegation.Findings))
+	}
+	s.lint(r.Lint)
+	if r.Takeover != nil {
+		s.takeover(r.Takeover)
+	}
+}
+
+// reportChecks records r like report, plus the -warn-days check on the
+// WHOIS result, which needs the threshold.
+func (s *runStatus) reportChecks(r *dnsReport, warnDays int) {
+	s.report(r)
+	if warnDays > 0 && r.Whois != nil && r.Whois.Kind == "domain" && r.Whois.ParseError == "" {
+		if warnings, _ := whoisWarnings(*r.Whois, warnDays); len(warnings) > 0 {
+			s.fail(exitFindings)
+		}
+	}
+}
+
+// brute records a wordlist enumeration. As with the inventory, a name that
+// fails to resolve is a warning; only when every query failed is it the
+// resolver, which fails the run. A wildcard is a warning too.
+func (s *runStatus) brute(rep *bruteReport) {
+	if rep.Errors > 0 && rep.Errors == rep.Tried {
+		s.failErr(rep.err)
+	} else {
+		s.warn(rep.Errors)
+	}
+	s.warn(len(rep.Wildcards))
+}
+
+// takeover records the takeover check: a dangling CNAME fails the run.
+func (s *runStatus) takeover(rep *takeoverReport) {
+	if rep.Errors > 0 {
+		s.failErr(rep.err)
+	}
+	if len(rep.Findings) > 0 {
+		s.fail(exitFindings)
+	}
+}
+
+// certs records the certificate analysis: a certificate the CAA records
+// do not allow fails the run, one that expires soon is a warning.
+func (s *runStatus) certs(rep *certReport) {
+	for _, err := range rep.caaErrs {
+		s.failErr(err)
+	}
+	if len(rep.UnexpectedCA) > 0 {
+		s.fail(exitFindings)
+	}
+	s.warn(len(rep.Expiring))
+}
+
+// inventory records the resolved CT names. A name that fails to resolve is
+// usually a stale or broken delegation, not a resolver problem, so it is a
+// warning.
+func (s *runStatus) inventory(infos []subdomainInfo) {
+	for _, info := range infos {
+		if info.Status == subError {
+			s.warn(1)
+		}
+	}
+}
+
+// lint records lint findings: errors fail the run, warnings count as
+// warnings and info is ignored.
+func (s *runStatus) lint(findings []lintFinding) {
+	for _, f := range findings {
+		switch f.Severity {
+		case sevError:
+			s.fail(exitFindings)
+		case sevWarning:
+			s.warn(1)
+		}
+	}
+}
+
+// exitCode returns the code for the run. With strict, warnings fail it.
+func (s *runStatus) exitCode(strict bool) int {
+	if s.code == exitOK && strict && s.warnings > 0 {
+		return exitFindings
+	}
+	return s.code
+}
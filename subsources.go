@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// subdomainSource is a passive source of subdomain names, such as a CT log
+// search or a file with an earlier dump. Sources that see certificates
+// return those too.
+type subdomainSource interface {
+	Name() string
+	Subdomains(ctx context.Context, domain string) ([]string, []ctCert, error)
+}
+
+// sourceConfig is one source in a -subs-config file.
+type sourceConfig struct {
+	Type      string  `yaml:"type"` // crtsh, mirror, certspotter or file
+	Name      string  `yaml:"name"`
+	URL       string  `yaml:"url"`
+	APIKey    string  `yaml:"api_key"`
+	APIKeyEnv string  `yaml:"api_key_env"`
+	Rate      float64 `yaml:"rate"` // requests per second, 0 = the default of the type
+	Path      string  `yaml:"path"`
+}
+
+// sourcesConfig is the layout of a -subs-config file.
+type sourcesConfig struct {
+	Sources []sourceConfig `yaml:"sources"`
+}
+
+// sourceLimiter spaces the requests to one source. It is shared by all
+// domains in batch mode, so the limit holds for the whole run.
+type sourceLimiter struct {
+	mu    sync.Mutex
+	every time.Duration
+	next  time.Time
+}
+
+func newSourceLimiter(rate float64) *sourceLimiter {
+	l := &sourceLimiter{}
+	if rate > 0 {
+		l.every = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+func (l *sourceLimiter) wait(ctx context.Context) error {
+	if l == nil || l.every == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.every)
+	l.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// newSubdomainSource builds a source from its configuration.
+func newSubdomainSource(c sourceConfig) (subdomainSource, error) {
+	key := c.APIKey
+	if key == "" && c.APIKeyEnv != "" {
+		key = os.Getenv(c.APIKeyEnv)
+	}
+	name := func(def string) string {
+		if c.Name != "" {
+			return c.Name
+		}
+		return def
+	}
+	switch strings.ToLower(c.Type) {
+	case "crtsh", "crt.sh":
+		return &crtshSource{name: name("crt.sh"), url: c.URL, limiter: newSourceLimiter(c.Rate)}, nil
+	case "mirror":
+		if c.URL == "" {
+			return nil, errors.New("bron mirror: url ontbreekt")
+		}
+		return &crtshSource{name: name("mirror"), url: c.URL, limiter: newSourceLimiter(c.Rate)}, nil
+	case "certspotter":
+		if key == "" && c.APIKeyEnv == "" {
+			key = os.Getenv("CERTSPOTTER_API_KEY")
+		}
+		rate := c.Rate
+		if rate == 0 {
+			rate = 1
+		}
+		return &certspotterSource{name: name("certspotter"), url: c.URL, apiKey: key, limiter: newSourceLimiter(rate)}, nil
+	case "file":
+		if c.Path == "" {
+			return nil, errors.New("bron file: path ontbreekt")
+		}
+		return &fileSource{name: name("file:" + c.Path), path: c.Path}, nil
+	}
+	return nil, fmt.Errorf("onbekende bron %q (crtsh, mirror, certspotter of file)", c.Type)
+}
+
+// subdomainSources builds the sources of a run: -subs-sources, the sources
+// in -subs-config and the -subs-import files. Without any, crt.sh is used;
+// with only imports the run stays offline.
+func subdomainSources(o options) ([]subdomainSource, error) {
+	var configs []sourceConfig
+	for _, t := range o.subsSources {
+		configs = append(configs, sourceConfig{Type: t})
+	}
+	if o.subsConfig != "" {
+		f, err := os.Open(o.subsConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var cfg sourcesConfig
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", o.subsConfig, err)
+		}
+		if len(cfg.Sources) == 0 {
+			return nil, fmt.Errorf("%s: geen bronnen", o.subsConfig)
+		}
+		configs = append(configs, cfg.Sources...)
+	}
+	for _, path := range o.subsImport {
+		configs = append(configs, sourceConfig{Type: "file", Path: path})
+	}
+	if len(configs) == 0 {
+		configs = append(configs, sourceConfig{Type: "crtsh"})
+	}
+
+	var out []subdomainSource
+	seen := map[string]bool{}
+	for _, c := range configs {
+		src, err := newSubdomainSource(c)
+		if err != nil {
+			return nil, err
+		}
+		if seen[src.Name()] {
+			return nil, fmt.Errorf("bron %q staat er twee keer in (geef een eigen name:)", src.Name())
+		}
+		seen[src.Name()] = true
+		out = append(out, src)
+	}
+	return out, nil
+}
+
+// subdomainResult is the merged output of all sources.
+type subdomainResult struct {
+	Names   []string            // sorted
+	Sources map[string][]string // per name, the sources that had it
+	Counts  map[string]int      // per source, the number of names
+	Errors  map[string]string   // per failed source
+	Certs   []ctCert            // deduplicated over the sources
+}
+
+// fetchSubdomains asks every source in parallel and merges the names. It
+// only fails when every source failed.
+func fetchSubdomains(ctx context.Context, domain string, sources []subdomainSource) (*subdomainResult, error) {
+	res := &subdomainResult{Sources: map[string][]string{}, Counts: map[string]int{}, Errors: map[string]string{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src subdomainSource) {
+			defer wg.Done()
+			names, certs, err := src.Subdomains(ctx, domain)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Errors[src.Name()] = err.Error()
+				return
+			}
+			res.Counts[src.Name()] = len(names)
+			for _, n := range names {
+				res.Sources[n] = append(res.Sources[n], src.Name())
+			}
+			res.Certs = append(res.Certs, certs...)
+		}(src)
+	}
+	wg.Wait()
+
+	res.Certs = dedupeCerts(res.Certs)
+
+	for n, srcs := range res.Sources {
+		sort.Strings(srcs)
+		res.Names = append(res.Names, n)
+	}
+	sort.Strings(res.Names)
+	if len(res.Errors) == len(sources) && len(sources) > 0 {
+		var msgs []string
+		for _, name := range sortedKeys(res.Errors) {
+			msgs = append(msgs, name+": "+res.Errors[name])
+		}
+		return res, errors.New(strings.Join(msgs, "; "))
+	}
+	return res, nil
+}
+
+// ctName cleans a raw name from a source: lower case, without the trailing
+// dot. ok is false for names that are not under domain.
+func ctName(domain, name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	bare := strings.TrimPrefix(name, "*.")
+	if bare == "" || !dns.IsSubDomain(dns.Fqdn(strings.ToLower(domain)), dns.Fqdn(bare)) {
+		return "", false
+	}
+	return name, true
+}
+
+// ctCollector gathers the names under domain, without a leading "*.", and
+// the certificates from the rows of a source.
+type ctCollector struct {
+	domain string
+	names  map[string]bool
+	certs  []ctCert
+}
+
+func newCTCollector(domain string) *ctCollector {
+	return &ctCollector{domain: domain, names: map[string]bool{}}
+}
+
+func (c *ctCollector) add(name string) []string {
+	name, ok := ctName(c.domain, name)
+	if !ok {
+		return nil
+	}
+	c.names[strings.TrimPrefix(name, "*.")] = true
+	return []string{name}
+}
+
+// row adds one row of a dump: a name, a crt.sh row (name_value, several
+// names separated by newlines) or a Cert Spotter row (dns_names). Rows
+// with an issuer and an expiry also give a certificate.
+func (c *ctCollector) row(row any) {
+	switch row := row.(type) {
+	case string:
+		c.add(row)
+	case map[string]any:
+		var names []string
+		if s, ok := row["name_value"].(string); ok {
+			for _, line := range strings.Split(s, "\n") {
+				names = append(names, c.add(line)...)
+			}
+		}
+		// dns_names is Cert Spotter, names the certificates in our own
+		// -json output.
+		for _, key := range []string{"dns_names", "names"} {
+			list, _ := row[key].([]any)
+			for _, n := range list {
+				if s, ok := n.(string); ok {
+					names = append(names, c.add(s)...)
+				}
+			}
+		}
+		if cert, ok := parseCTCert(row, names); ok {
+			c.certs = append(c.certs, cert)
+		}
+	}
+}
+
+func (c *ctCollector) result() ([]string, []ctCert, error) {
+	out := sortedKeys(c.names)
+	sort.Strings(out)
+	return out, dedupeCerts(c.certs), nil
+}
+
+// httpGetJSON fetches u and returns the body; a non-200 status is an
+// error with the start of the body.
+func httpGetJSON(ctx context.Context, u string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "ultradns/"+version)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// crtshSource searches crt.sh, or a mirror with the same JSON API.
+type crtshSource struct {
+	name    string
+	url     string // default https://crt.sh/
+	limiter *sourceLimiter
+}
+
+func (s *crtshSource) Name() string { return s.name }
+
+func (s *crtshSource) Subdomains(ctx context.Context, domain string) ([]string, []ctCert, error) {
+	base := s.url
+	if base == "" {
+		base = "https://crt.sh/"
+	}
+	if err := s.limiter.wait(ctx); err != nil {
+		return nil, nil, err
+	}
+	body, err := httpGetJSON(ctx, base+"?q="+url.QueryEscape("%."+domain)+"&output=json", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sometimes crt.sh returns invalid JSON when empty or rate-limited.
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		trim := strings.TrimSpace(string(body))
+		if trim == "" || strings.Contains(strings.ToLower(trim), "rate") {
+			return nil, nil, errors.New("geen geldige JSON (mogelijk rate limit)")
+		}
+		return nil, nil, err
+	}
+	c := newCTCollector(domain)
+	for _, row := range rows {
+		c.row(row)
+	}
+	return c.result()
+}
+
+// certspotterSource searches the Cert Spotter issuances API. Without an
+// API key the (small) anonymous quota applies.
+type certspotterSource struct {
+	name    string
+	url     string // default https://api.certspotter.com/v1/issuances
+	apiKey  string
+	limiter *sourceLimiter
+}
+
+func (s *certspotterSource) Name() string { return s.name }
+
+func (s *certspotterSource) Subdomains(ctx context.Context, domain string) ([]string, []ctCert, error) {
+	base := s.url
+	if base == "" {
+		base = "https://api.certspotter.com/v1/issuances"
+	}
+	header := http.Header{}
+	if s.apiKey != "" {
+		header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	c := newCTCollector(domain)
+	after := ""
+	// The API pages by issuance id; stop after 50 pages either way.
+	for page := 0; page < 50; page++ {
+		q := url.Values{"domain": {domain}, "include_subdomains": {"true"}, "expand": {"dns_names", "issuer"}}
+		if after != "" {
+			q.Set("after", after)
+		}
+		if err := s.limiter.wait(ctx); err != nil {
+			return nil, nil, err
+		}
+		body, err := httpGetJSON(ctx, base+"?"+q.Encode(), header)
+		if err != nil {
+			return nil, nil, err
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(body, &rows); err != nil {
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			c.row(row)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		id, _ := rows[len(rows)-1]["id"].(string)
+		if id == "" {
+			break
+		}
+		after = id
+	}
+	return c.result()
+}
+
+// fileSource reads names from a JSON dump on disk: a crt.sh or Cert
+// Spotter response, a list of names, or the -json output of ultradns.
+type fileSource struct {
+	name string
+	path string
+}
+
+func (s *fileSource) Name() string { return s.name }
+
+func (s *fileSource) Subdomains(ctx context.Context, domain string) ([]string, []ctCert, error) {
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	c := newCTCollector(domain)
+	switch v := v.(type) {
+	case []any:
+		for _, row := range v {
+			c.row(row)
+		}
+	case map[string]any:
+		// An ultradns -json report.
+		subs, _ := v["subdomains"].([]any)
+		for _, n := range subs {
+			c.row(n)
+		}
+		if certs, ok := v["certificates"].(map[string]any); ok {
+			list, _ := certs["list"].([]any)
+			for _, row := range list {
+				c.row(row)
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("%s: onbekend formaat", s.path)
+	}
+	return c.result()
+}
+
+// printSubdomainSources prints how many names each source gave and which
+// ones failed.
+func printSubdomainSources(res *subdomainResult, sources []subdomainSource) {
+	for _, src := range sources {
+		if msg, ok := res.Errors[src.Name()]; ok {
+			fmt.Printf("error: %s: %s\n", src.Name(), msg)
+			continue
+		}
+		fmt.Printf("%s: %d namen\n", src.Name(), res.Counts[src.Name()])
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// takeoverFingerprint describes a service where a CNAME to a deprovisioned
+// resource can be claimed by someone else. The JSON layout is that of the
+// can-i-take-over-xyz fingerprints.json, so that list can be used as is
+// with -takeover-db.
+type takeoverFingerprint struct {
+	Service     string   `json:"service"`
+	CNAME       []string `json:"cname"`                 // substrings of the CNAME target
+	Fingerprint string   `json:"fingerprint,omitempty"` // text in the HTTP response of an unclaimed resource
+	HTTPStatus  *int     `json:"http_status,omitempty"`
+	NXDomain    bool     `json:"nxdomain,omitempty"` // unclaimed resources have an NXDOMAIN target
+	Status      string   `json:"status,omitempty"`   // Vulnerable, Edge case, Not vulnerable
+	Vulnerable  bool     `json:"vulnerable"`
+}
+
+// defaultTakeoverDB holds the well known takeover-prone services.
+var defaultTakeoverDB = []takeoverFingerprint{
+	{Service: "AWS/S3", CNAME: []string{"s3.amazonaws.com", "s3-website"}, Fingerprint: "The specified bucket does not exist", Status: "Vulnerable", Vulnerable: true},
+	{Service: "AWS/Elastic Beanstalk", CNAME: []string{"elasticbeanstalk.com"}, NXDomain: true, Status: "Vulnerable", Vulnerable: true},
+	{Service: "GitHub Pages", CNAME: []string{"github.io"}, Fingerprint: "There isn't a GitHub Pages site here.", Status: "Edge case", Vulnerable: true},
+	{Service: "Microsoft Azure", CNAME: []string{"azurewebsites.net", "cloudapp.net", "cloudapp.azure.com", "trafficmanager.net", "blob.core.windows.net", "azure-api.net", "azureedge.net", "azurefd.net"}, NXDomain: true, Status: "Vulnerable", Vulnerable: true},
+	{Service: "Heroku", CNAME: []string{"herokuapp.com", "herokudns.com"}, Fingerprint: "No such app", Status: "Edge case", Vulnerable: true},
+	{Service: "Shopify", CNAME: []string{"myshopify.com"}, Fingerprint: "Sorry, this shop is currently unavailable.", Status: "Edge case", Vulnerable: true},
+	{Service: "Fastly", CNAME: []string{"fastly.net"}, Fingerprint: "Fastly error: unknown domain", Status: "Edge case", Vulnerable: true},
+	{Service: "Netlify", CNAME: []string{"netlify.app", "netlify.com"}, Fingerprint: "Not Found - Request ID", Status: "Edge case", Vulnerable: true},
+	{Service: "Pantheon", CNAME: []string{"pantheonsite.io"}, Fingerprint: "The gods are wise, but do not know of the site which you seek.", Status: "Vulnerable", Vulnerable: true},
+	{Service: "Ghost", CNAME: []string{"ghost.io"}, Fingerprint: "Failed to resolve DNS path for this host", Status: "Vulnerable", Vulnerable: true},
+	{Service: "Surge.sh", CNAME: []string{"surge.sh"}, Fingerprint: "project not found", Status: "Vulnerable", Vulnerable: true},
+	{Service: "Bitbucket", CNAME: []string{"bitbucket.io"}, Fingerprint: "Repository not found", Status: "Vulnerable", Vulnerable: true},
+	{Service: "Zendesk", CNAME: []string{"zendesk.com"}, Fingerprint: "Help Center Closed", Status: "Edge case", Vulnerable: true},
+	{Service: "Unbounce", CNAME: []string{"unbouncepages.com"}, Fingerprint: "The requested URL was not found on this server.", Status: "Edge case", Vulnerable: true},
+	{Service: "Readme.io", CNAME: []string{"readme.io"}, Fingerprint: "Project doesnt exist... yet!", Status: "Vulnerable", Vulnerable: true},
+	{Service: "Tumblr", CNAME: []string{"domains.tumblr.com"}, Fingerprint: "Whatever you were looking for doesn't currently exist at this address.", Status: "Edge case", Vulnerable: true},
+	{Service: "WordPress.com", CNAME: []string{"wordpress.com"}, Fingerprint: "Do you want to register", Status: "Vulnerable", Vulnerable: true},
+}
+
+// loadTakeoverDB reads a fingerprint database; without a path it returns
+// the built-in one. A file replaces the built-in list.
+func loadTakeoverDB(path string) ([]takeoverFingerprint, error) {
+	if path == "" {
+		return defaultTakeoverDB, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var db []takeoverFingerprint
+	if err := json.Unmarshal(b, &db); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Entries without a cname (services taken over through NS or MX
+	// records, say) occur in the upstream list; they cannot match a CNAME
+	// chain, so they are skipped.
+	var out []takeoverFingerprint
+	for i, fp := range db {
+		if len(fp.CNAME) == 0 {
+			continue
+		}
+		if fp.Service == "" {
+			return nil, fmt.Errorf("%s: fingerprint %d heeft geen service", path, i+1)
+		}
+		out = append(out, fp)
+	}
+	db = out
+	if len(db) == 0 {
+		return nil, fmt.Errorf("%s: geen fingerprints", path)
+	}
+	return db, nil
+}
+
+// matchFingerprint returns the fingerprint whose CNAME patterns occur in
+// one of the names of chain, or nil.
+func matchFingerprint(db []takeoverFingerprint, chain []string) *takeoverFingerprint {
+	for i := range db {
+		for _, pattern := range db[i].CNAME {
+			pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+			if pattern == "" {
+				continue
+			}
+			for _, name := range chain {
+				if strings.Contains(strings.TrimSuffix(name, "."), pattern) {
+					return &db[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// takeoverFinding is a name whose CNAME chain ends at something that can
+// be claimed: a target that does not exist, or a service that answers with
+// its "not found" page.
+type takeoverFinding struct {
+	Name     string   `json:"name"`
+	Chain    []string `json:"chain"`
+	Reason   string   `json:"reason"` // nxdomain or fingerprint
+	Service  string   `json:"service,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Evidence string   `json:"evidence,omitempty"`
+}
+
+// takeoverReport is the result of the takeover check.
+type takeoverReport struct {
+	Checked  int               `json:"checked"`
+	CNAMEs   int               `json:"cnames"`
+	Findings []takeoverFinding `json:"findings"`
+	Errors   int               `json:"errors,omitempty"`
+	Error    string            `json:"error,omitempty"` // the first one
+	err      error
+}
+
+// takeoverInputs loads the fingerprint database (-takeover-db) and the
+// records of -takeover-zone for domain.
+func takeoverInputs(o options, domain string) ([]takeoverFingerprint, []dns.RR, error) {
+	db, err := loadTakeoverDB(o.takeoverDB)
+	if err != nil || o.takeoverZone == "" {
+		return db, nil, err
+	}
+	rrs, _, err := loadZoneFile(o.takeoverZone, dns.Fqdn(domain))
+	return db, rrs, err
+}
+
+// takeoverNames gathers the names to check: the owner names of the zone
+// records, names from a zone file, and those found via CT and the
+// wordlist. Wildcard names are skipped.
+func takeoverNames(zone []dnsRecord, zoneFile []dns.RR, ct []string, brute *bruteReport) []string {
+	set := map[string]bool{}
+	add := func(name string) {
+		name = dns.Fqdn(strings.ToLower(strings.TrimSpace(name)))
+		if name == "." || strings.HasPrefix(name, "*.") {
+			return
+		}
+		set[name] = true
+	}
+	for _, rec := range zone {
+		add(rec.Name)
+	}
+	for _, rr := range zoneFile {
+		add(rr.Header().Name)
+	}
+	for _, name := range ct {
+		add(name)
+	}
+	if brute != nil {
+		for _, h := range brute.Found {
+			add(h.Name)
+		}
+	}
+	names := sortedKeys(set)
+	sort.SliceStable(names, func(i, j int) bool { return zoneNameLess(names[i], names[j]) })
+	return names
+}
+
+// followCNAME returns the CNAME chain of name, without name itself. It is
+// empty when name is not a CNAME.
+func followCNAME(ctx context.Context, client *dns.Client, resolver, name string) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{name: true}
+	for cur := name; len(chain) < 10; {
+		in, err := queryRecursive(ctx, client, resolver, cur, dns.TypeCNAME)
+		if err = answerError(in, err); err != nil {
+			return chain, err
+		}
+		next := ""
+		for _, rr := range in.Answer {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, cur) {
+				next = strings.ToLower(c.Target)
+				break
+			}
+		}
+		if next == "" || seen[next] {
+			break
+		}
+		seen[next] = true
+		chain = append(chain, next)
+		cur = next
+	}
+	return chain, nil
+}
+
+// checkTakeover follows the CNAME chain of every name and reports chains
+// that end in NXDOMAIN, or at a service from db that shows its fingerprint.
+func checkTakeover(ctx context.Context, client *dns.Client, resolver string, names []string, db []takeoverFingerprint, workers int) *takeoverReport {
+	if workers < 1 {
+		workers = 1
+	}
+	rep := &takeoverReport{Checked: len(names), Findings: []takeoverFinding{}}
+	var mu sync.Mutex
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		rep.Errors++
+		if rep.err == nil {
+			rep.Error, rep.err = err.Error(), err
+		}
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				chain, err := followCNAME(ctx, client, resolver, name)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				if len(chain) == 0 {
+					continue
+				}
+				f, err := takeoverCheck(ctx, client, resolver, name, chain, db)
+				if err != nil {
+					fail(err)
+				}
+				mu.Lock()
+				rep.CNAMEs++
+				if f != nil {
+					rep.Findings = append(rep.Findings, *f)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- name
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(rep.Findings, func(i, j int) bool { return zoneNameLess(rep.Findings[i].Name, rep.Findings[j].Name) })
+	return rep
+}
+
+// takeoverCheck looks at the end of one chain. Fingerprints marked not
+// vulnerable only count for NXDOMAIN targets.
+func takeoverCheck(ctx context.Context, client *dns.Client, resolver, name string, chain []string, db []takeoverFingerprint) (*takeoverFinding, error) {
+	fp := matchFingerprint(db, chain)
+	f := &takeoverFinding{Name: name, Chain: chain}
+	if fp != nil {
+		f.Service, f.Status = fp.Service, fp.Status
+	}
+
+	h, exists, err := bruteLookup(ctx, client, resolver, chain[len(chain)-1])
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		f.Reason = "nxdomain"
+		return f, nil
+	}
+	if fp == nil || !fp.Vulnerable || fp.NXDomain || fp.Fingerprint == "" || len(h.IPs) == 0 {
+		return nil, nil
+	}
+
+	host := strings.TrimSuffix(name, ".")
+	probe := probeClient(h.IPs[0])
+	defer probe.CloseIdleConnections()
+	for _, scheme := range []string{"https", "http"} {
+		p, body := fetchProbe(ctx, probe, scheme+"://"+host+"/")
+		if p.Error != "" {
+			continue
+		}
+		if fp.HTTPStatus != nil && p.Status != *fp.HTTPStatus {
+			continue
+		}
+		if strings.Contains(string(body), fp.Fingerprint) {
+			f.Reason, f.Evidence = "fingerprint", p.URL
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+func printTakeover(rep *takeoverReport) {
+	fmt.Printf("%d namen gecontroleerd, %d CNAMEs gevolgd\n", rep.Checked, rep.CNAMEs)
+	if rep.Errors > 0 {
+		fmt.Printf("error: %d lookups mislukt (eerste: %s)\n", rep.Errors, rep.Error)
+	}
+	if len(rep.Findings) == 0 {
+		fmt.Println("Geen dangling CNAMEs gevonden")
+		return
+	}
+	for _, f := range rep.Findings {
+		chain := strings.TrimSuffix(f.Name, ".")
+		for _, c := range f.Chain {
+			chain += " -> " + strings.TrimSuffix(c, ".")
+		}
+		var what string
+		switch f.Reason {
+		case "nxdomain":
+			what = "doel bestaat niet (NXDOMAIN)"
+		case "fingerprint":
+			what = "niet geclaimde resource op " + f.Evidence
+		}
+		if f.Service != "" {
+			what += fmt.Sprintf(" [%s", f.Service)
+			if f.Status != "" {
+				what += ", " + f.Status
+			}
+			what += "]"
+		}
+		fmt.Printf("[!] %s: %s\n", chain, what)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RFC 8460 section 4.4: aggregate report format.
+type tlsrptReport struct {
+	OrganizationName string `json:"organization-name"`
+	DateRange        struct {
+		Start string `json:"start-datetime"`
+		End   string `json:"end-datetime"`
+	} `json:"date-range"`
+	ContactInfo string         `json:"contact-info"`
+	ReportID    string         `json:"report-id"`
+	Policies    []tlsrptPolicy `json:"policies"`
+}
+
+type tlsrptPolicy struct {
+	Policy struct {
+		Type         string   `json:"policy-type"`
+		PolicyString []string `json:"policy-string"`
+		Domain       string   `json:"policy-domain"`
+		MXHost       []string `json:"mx-host"`
+	} `json:"policy"`
+	Summary struct {
+		Success int64 `json:"total-successful-session-count"`
+		Failure int64 `json:"total-failure-session-count"`
+	} `json:"summary"`
+	FailureDetails []tlsrptFailure `json:"failure-details"`
+}
+
+type tlsrptFailure struct {
+	ResultType        string `json:"result-type"`
+	SendingMTAIP      string `json:"sending-mta-ip"`
+	ReceivingMXHost   string `json:"receiving-mx-hostname"`
+	ReceivingMXHelo   string `json:"receiving-mx-helo"`
+	ReceivingIP       string `json:"receiving-ip"`
+	FailedSessions    int64  `json:"failed-session-count"`
+	AdditionalInfo    string `json:"additional-information"`
+	FailureReasonCode string `json:"failure-reason-code"`
+}
+
+// Result types that point at a problem on the receiving MX itself
+// (no STARTTLS offered or a certificate that does not validate).
+var tlsrptMXResultTypes = map[string]bool{
+	"starttls-not-supported":    true,
+	"certificate-host-mismatch": true,
+	"certificate-expired":       true,
+	"certificate-not-trusted":   true,
+	"validation-failure":        true,
+}
+
+type tlsrptPolicyStats struct {
+	success  int64
+	failure  int64
+	failures map[string]int64
+}
+
+type tlsrptMXStats struct {
+	failures map[string]int64
+	ips      map[string]struct{}
+}
+
+func runTLSRPTCmd(args []string) int {
+	fs := flag.NewFlagSet("tlsrpt", flag.ExitOnError)
+	fs.Usage = func() {
+		printBanner()
+		fmt.Fprintf(os.Stderr, "Gebruik:\n")
+		fmt.Fprintf(os.Stderr, "  ultradns tlsrpt <rapport.json[.gz]> [...]\n")
+		fmt.Fprintf(os.Stderr, "  ultradns tlsrpt - (lees een rapport van stdin)\n\n")
+		fmt.Fprintf(os.Stderr, "Leest TLS-RPT rapporten (RFC 8460) en vat sessies per policy en fouttype samen.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var reports []tlsrptReport
+	failed := false
+	for _, path := range fs.Args() {
+		r, err := readTLSRPTReport(path)
+		if err != nil {
+			fmt.Printf("%s: error: %v\n", path, err)
+			failed = true
+			continue
+		}
+		reports = append(reports, r)
+	}
+	if len(reports) == 0 {
+		return exitFindings
+	}
+
+	printBanner()
+	fmt.Println()
+	printTLSRPTSummary(reports)
+	if failed {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// readTLSRPTReport reads a plain or gzipped JSON report. Gzip is detected
+// on the magic bytes, as reporters are not consistent with file extensions.
+func readTLSRPTReport(path string) (tlsrptReport, error) {
+	var r tlsrptReport
+
+	var in io.Reader
+	if path == "-" {
+		in = os.Stdin
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return r, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	br := bufio.NewReader(in)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return r, err
+		}
+		defer gz.Close()
+		in = gz
+	} else {
+		in = br
+	}
+
+	if err := json.NewDecoder(in).Decode(&r); err != nil {
+		return r, fmt.Errorf("ongeldige TLS-RPT JSON: %w", err)
+	}
+	return r, nil
+}
+
+func printTLSRPTSummary(reports []tlsrptReport) {
+	printHeader("TLS-RPT RAPPORTEN")
+	for _, r := range reports {
+		fmt.Printf("  - %s (%s t/m %s) id=%s\n", safe(r.OrganizationName), safe(r.DateRange.Start), safe(r.DateRange.End), safe(r.ReportID))
+	}
+	fmt.Println()
+
+	policies := map[string]*tlsrptPolicyStats{}
+	mxHosts := map[string]*tlsrptMXStats{}
+	var totalOK, totalFail int64
+
+	for _, r := range reports {
+		for _, p := range r.Policies {
+			key := p.Policy.Type + " " + safe(p.Policy.Domain)
+			ps, ok := policies[key]
+			if !ok {
+				ps = &tlsrptPolicyStats{failures: map[string]int64{}}
+				policies[key] = ps
+			}
+			ps.success += p.Summary.Success
+			ps.failure += p.Summary.Failure
+			totalOK += p.Summary.Success
+			totalFail += p.Summary.Failure
+
+			for _, fd := range p.FailureDetails {
+				ps.failures[fd.ResultType] += fd.FailedSessions
+				if !tlsrptMXResultTypes[fd.ResultType] {
+					continue
+				}
+				host := strings.TrimSuffix(fd.ReceivingMXHost, ".")
+				if host == "" {
+					host = safe(fd.ReceivingIP)
+				}
+				ms, ok := mxHosts[host]
+				if !ok {
+					ms = &tlsrptMXStats{failures: map[string]int64{}, ips: map[string]struct{}{}}
+					mxHosts[host] = ms
+				}
+				ms.failures[fd.ResultType] += fd.FailedSessions
+				if fd.ReceivingIP != "" {
+					ms.ips[fd.ReceivingIP] = struct{}{}
+				}
+			}
+		}
+	}
+
+	printHeader("SESSIES PER POLICY")
+	for _, key := range sortedKeys(policies) {
+		ps := policies[key]
+		fmt.Printf("%s: %d geslaagd, %d mislukt%s\n", key, ps.success, ps.failure, failureRate(ps.success, ps.failure))
+		for _, rt := range sortedKeys(ps.failures) {
+			fmt.Printf("    %s: %d\n", rt, ps.failures[rt])
+		}
+	}
+	fmt.Printf("Totaal: %d geslaagd, %d mislukt%s\n\n", totalOK, totalFail, failureRate(totalOK, totalFail))
+
+	printHeader("MX HOSTS MET STARTTLS/CERTIFICAAT FOUTEN")
+	if len(mxHosts) == 0 {
+		fmt.Println("(geen)")
+		fmt.Println()
+		return
+	}
+	for _, host := range sortedKeys(mxHosts) {
+		ms := mxHosts[host]
+		fmt.Printf("[!] %s", host)
+		if len(ms.ips) > 0 {
+			fmt.Printf(" (%s)", strings.Join(sortedKeys(ms.ips), ", "))
+		}
+		fmt.Println()
+		for _, rt := range sortedKeys(ms.failures) {
+			fmt.Printf("    %s: %d sessie(s)\n", rt, ms.failures[rt])
+		}
+	}
+	fmt.Println()
+}
+
+func failureRate(ok, fail int64) string {
+	if ok+fail == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f%% mislukt)", float64(fail)*100/float64(ok+fail))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
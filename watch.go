@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// watchEvent is emitted when a run differs from the previous one.
+type watchEvent struct {
+	Time     time.Time        `json:"time"`
+	Domain   string           `json:"domain"`
+	Previous time.Time        `json:"previous"`
+	Changes  []snapshotChange `json:"changes"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// watchStatus decides the exit code of a watch session. A failed poll or
+// webhook post is reported and retried on the next tick, so the session
+// only exits with an error when every poll or every post failed. A failed
+// post is not a DNS error, so it exits with 1 rather than a DNS code.
+type watchStatus struct {
+	polls, failedPolls int
+	posts, failedPosts int
+	pollErr            runStatus
+}
+
+func (w *watchStatus) poll(r *dnsReport) {
+	w.polls++
+	if len(r.failures()) > 0 {
+		w.failedPolls++
+		w.pollErr.report(r)
+	}
+}
+
+func (w *watchStatus) post(err error) {
+	w.posts++
+	if err != nil {
+		w.failedPosts++
+	}
+}
+
+func (w *watchStatus) exitCode() int {
+	var st runStatus
+	if w.polls > 0 && w.failedPolls == w.polls {
+		st.fail(w.pollErr.exitCode(false))
+	}
+	if w.posts > 0 && w.failedPosts == w.posts {
+		st.fail(exitFindings)
+	}
+	return st.exitCode(false)
+}
+
+// runWatch re-runs the selected checks every o.watch until interrupted and
+// reports the differences with the previous run. With -watch-state the last
+// snapshot is kept on disk, so a restart compares against the state from
+// before the restart instead of starting a new baseline. The exit code is
+// that of watchStatus.
+func runWatch(client *dns.Client, resolver, domain string, o options, srvCatalogue []srvService) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var prev *snapshot
+	if o.watchState != "" {
+		if s, err := readSnapshot(o.watchState); err == nil && s.Domain == domain {
+			prev = s
+			fmt.Printf("vorige staat geladen uit %s (%s)\n", o.watchState, s.Time.Format(time.RFC3339))
+		} else if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	var log *os.File
+	if o.watchLog != "" {
+		f, err := os.OpenFile(o.watchLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		log = f
+	}
+
+	fmt.Printf("watch: %s elke %s (stop met Ctrl+C)\n", domain, o.watch)
+	ticker := time.NewTicker(o.watch)
+	defer ticker.Stop()
+	var ws watchStatus
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, runTimeout(o))
+		r := buildReport(runCtx, client, resolver, domain, o, srvCatalogue, nil)
+		cancel()
+		if ctx.Err() != nil {
+			return ws.exitCode()
+		}
+		ws.poll(r)
+		cur := makeSnapshot(r)
+
+		if prev == nil {
+			fmt.Printf("[%s] baseline: %d records\n", cur.Time.Format(time.RFC3339), len(cur.Records))
+		} else {
+			changes, warnings := diffSnapshots(prev, cur)
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "[%s] [!] %s\n", cur.Time.Format(time.RFC3339), w)
+			}
+			if len(changes) > 0 {
+				ev := watchEvent{Time: cur.Time, Domain: domain, Previous: prev.Time, Changes: changes, Warnings: warnings}
+				if err := emitWatchEvent(ctx, ev, log, o.webhook); o.webhook != "" {
+					ws.post(err)
+				}
+			}
+		}
+
+		// Keep the last good state for record sets that failed this run,
+		// so a timeout is not reported as a change on the next run.
+		if prev != nil && len(cur.Errors) > 0 {
+			cur = mergeFailedRRsets(prev, cur)
+		}
+		prev = cur
+		if o.watchState != "" {
+			if err := writeSnapshotFile(o.watchState, cur); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ws.exitCode()
+		case <-ticker.C:
+		}
+	}
+}
+
+// emitWatchEvent prints ev and appends it to log and webhook when set. It
+// returns the webhook error; a failed log write is only reported.
+func emitWatchEvent(ctx context.Context, ev watchEvent, log *os.File, webhook string) error {
+	fmt.Printf("[%s] %d wijziging(en) voor %s:\n", ev.Time.Format(time.RFC3339), len(ev.Changes), ev.Domain)
+	for _, c := range ev.Changes {
+		fmt.Printf("  %s\n", c)
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return err
+	}
+	if log != nil {
+		if _, err := log.Write(append(body, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "error: watch log: %v\n", err)
+		}
+	}
+	if webhook != "" {
+		if err := postWebhook(ctx, webhook, body); err != nil {
+			fmt.Fprintf(os.Stderr, "error: webhook: %v\n", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func postWebhook(ctx context.Context, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ultradns/"+version)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// mergeFailedRRsets copies the records of RRsets that errored in cur from
+// prev, and the mail/WHOIS state when those sections failed entirely.
+func mergeFailedRRsets(prev, cur *snapshot) *snapshot {
+	merged := *cur
+	merged.Records = append([]dnsRecord{}, cur.Records...)
+	for _, r := range prev.Records {
+		if _, failed := cur.Errors[r.Name+" "+r.Type]; failed {
+			merged.Records = append(merged.Records, r)
+		}
+	}
+	if _, failed := cur.Errors["whois"]; failed {
+		merged.Whois = prev.Whois
+	}
+	if merged.Mail == nil {
+		merged.Mail = prev.Mail
+	} else if prev.Mail != nil {
+		m := *merged.Mail
+		for _, f := range []struct {
+			check    string
+			dst      *string
+			previous string
+		}{
+			{"SPF", &m.SPF, prev.Mail.SPF},
+			{"DMARC", &m.DMARC, prev.Mail.DMARC},
+			{"MTA-STS", &m.MTASTS, prev.Mail.MTASTS},
+			{"TLS-RPT", &m.TLSRPT, prev.Mail.TLSRPT},
+		} {
+			if _, failed := cur.Errors["mail "+f.check]; failed {
+				*f.dst = f.previous
+			}
+		}
+		// The DKIM map is copied, so merging leaves cur untouched.
+		dkim := map[string]string{}
+		for sel, rec := range m.DKIM {
+			dkim[sel] = rec
+		}
+		for sel, rec := range prev.Mail.DKIM {
+			if _, failed := cur.Errors["mail DKIM "+sel]; failed {
+				dkim[sel] = rec
+			}
+		}
+		m.DKIM = nil
+		if len(dkim) > 0 {
+			m.DKIM = dkim
+		}
+		merged.Mail = &m
+	}
+	merged.Errors = nil
+	return &merged
+}
+
+func writeSnapshotFile(path string, s *snapshot) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testWatchEvent() watchEvent {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	return watchEvent{
+		Time:     now,
+		Domain:   "example.com",
+		Previous: now.Add(-5 * time.Minute),
+		Changes:  []snapshotChange{{Kind: "changed", Section: "records", Key: "www.example.com. A", Old: "192.0.2.1", New: "192.0.2.2"}},
+	}
+}
+
+func TestEmitWatchEventWebhook(t *testing.T) {
+	var got watchEvent
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	log, err := os.Create(filepath.Join(t.TempDir(), "watch.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	ev := testWatchEvent()
+	if err := emitWatchEvent(context.Background(), ev, log, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("content type = %q", contentType)
+	}
+	if got.Domain != ev.Domain || !got.Time.Equal(ev.Time) || len(got.Changes) != 1 || got.Changes[0] != ev.Changes[0] {
+		t.Errorf("webhook got %+v, want %+v", got, ev)
+	}
+
+	b, err := os.ReadFile(log.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"www.example.com. A"`) {
+		t.Errorf("log = %q, want one JSON line with the change", b)
+	}
+}
+
+func TestPostWebhookStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "stuk", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := postWebhook(context.Background(), srv.URL, []byte("{}")); err == nil || err.Error() != "HTTP 500" {
+		t.Errorf("err = %v, want HTTP 500", err)
+	}
+	if err := emitWatchEvent(context.Background(), testWatchEvent(), nil, srv.URL); err == nil {
+		t.Error("emitWatchEvent: no error for a failing webhook")
+	}
+}
+
+func TestMergeFailedRRsets(t *testing.T) {
+	prev := &snapshot{
+		Records: []dnsRecord{
+			{Name: "example.com.", Type: "A", Data: "192.0.2.1"},
+			{Name: "example.com.", Type: "MX", Data: "10 mail.example.com."},
+			{Name: "example.com.", Type: "TXT", Data: `"old"`},
+		},
+		Mail:  &snapshotMail{SPF: "v=spf1 -all", DMARC: "v=DMARC1; p=reject", DKIM: map[string]string{"s1": "v=DKIM1; p=old1", "s2": "v=DKIM1; p=old2"}},
+		Whois: &snapshotWhois{Registrar: "Old Registrar"},
+	}
+	cur := &snapshot{
+		Records: []dnsRecord{
+			{Name: "example.com.", Type: "A", Data: "192.0.2.2"},
+			{Name: "example.com.", Type: "TXT", Data: `"new"`},
+		},
+		Mail: &snapshotMail{DMARC: "v=DMARC1; p=none", DKIM: map[string]string{"s2": "v=DKIM1; p=new2"}},
+		Errors: map[string]string{
+			"example.com. MX": "timeout",
+			"mail SPF":        "timeout",
+			"mail DKIM s1":    "timeout",
+			"whois":           "timeout",
+		},
+	}
+
+	merged := mergeFailedRRsets(prev, cur)
+	var recs []string
+	for _, r := range merged.Records {
+		recs = append(recs, r.Type+" "+r.Data)
+	}
+	if got, want := strings.Join(recs, ", "), `A 192.0.2.2, TXT "new", MX 10 mail.example.com.`; got != want {
+		t.Errorf("records = %s, want %s", got, want)
+	}
+	if merged.Mail.SPF != "v=spf1 -all" || merged.Mail.DMARC != "v=DMARC1; p=none" {
+		t.Errorf("mail = %+v, want the old SPF and the new DMARC", merged.Mail)
+	}
+	if got := merged.Mail.DKIM; len(got) != 2 || got["s1"] != "v=DKIM1; p=old1" || got["s2"] != "v=DKIM1; p=new2" {
+		t.Errorf("dkim = %v, want the old s1 and the new s2", got)
+	}
+	if merged.Whois == nil || merged.Whois.Registrar != "Old Registrar" {
+		t.Errorf("whois = %+v, want the previous one", merged.Whois)
+	}
+	if merged.Errors != nil {
+		t.Errorf("errors = %v, want none", merged.Errors)
+	}
+	if len(cur.Records) != 2 || cur.Mail.SPF != "" || len(cur.Mail.DKIM) != 1 {
+		t.Error("cur was modified")
+	}
+}
+
+// A name typed in another case must still match the lowercased records.
+func TestMakeSnapshotErrorKey(t *testing.T) {
+	r := &dnsReport{Domain: "example.com", Queries: []queryResult{{Name: "Example.COM.", Type: "MX", Error: "timeout"}}}
+	prev := &snapshot{Records: []dnsRecord{{Name: "example.com.", Type: "MX", Data: "10 mail.example.com."}}}
+	if merged := mergeFailedRRsets(prev, makeSnapshot(r)); len(merged.Records) != 1 {
+		t.Errorf("records = %v, want the previous MX", merged.Records)
+	}
+}
+
+func TestWatchStatus(t *testing.T) {
+	failed := &dnsReport{Domain: "example.com", Queries: []queryResult{{Name: "example.com.", Type: "A", Error: "timeout", err: context.DeadlineExceeded}}}
+	ok := &dnsReport{Domain: "example.com", Queries: []queryResult{{Name: "example.com.", Type: "A"}}}
+
+	var ws watchStatus
+	ws.poll(failed)
+	ws.poll(ok)
+	ws.post(nil)
+	if code := ws.exitCode(); code != exitOK {
+		t.Errorf("recovered session: exit %d, want %d", code, exitOK)
+	}
+
+	ws = watchStatus{}
+	ws.poll(failed)
+	ws.poll(failed)
+	if code := ws.exitCode(); code != exitTimeout {
+		t.Errorf("every poll failed: exit %d, want %d", code, exitTimeout)
+	}
+
+	ws = watchStatus{}
+	ws.poll(ok)
+	ws.post(errors.New("HTTP 500"))
+	if code := ws.exitCode(); code != exitFindings {
+		t.Errorf("every post failed: exit %d, want %d", code, exitFindings)
+	}
+
+	ws = watchStatus{}
+	ws.poll(ok)
+	ws.post(&net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	if code := ws.exitCode(); code != exitFindings {
+		t.Errorf("webhook unreachable: exit %d, want %d", code, exitFindings)
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	whois "github.com/likexian/whois"
+	whoisparser "github.com/likexian/whois-parser"
+)
+
+// whoisResult is the registration data for a domain, IP network or ASN,
+// regardless of whether it came from RDAP or port-43 WHOIS.
+type whoisResult struct {
+	Query  string `json:"query"`
+	Kind   string `json:"kind"`   // domain, ip or asn
+	Source string `json:"source"` // rdap or whois
+	Server string `json:"server,omitempty"`
+
+	Domain      string        `json:"domain,omitempty"`
+	Handle      string        `json:"handle,omitempty"`
+	Name        string        `json:"name,omitempty"`
+	Range       string        `json:"range,omitempty"`
+	Country     string        `json:"country,omitempty"`
+	Status      []string      `json:"status,omitempty"`
+	Created     string        `json:"created,omitempty"`
+	Updated     string        `json:"updated,omitempty"`
+	Expires     string        `json:"expires,omitempty"`
+	CreatedAt   *time.Time    `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time    `json:"updated_at,omitempty"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"`
+	DaysLeft    *int          `json:"days_until_expiry,omitempty"`
+	Registrar   string        `json:"registrar,omitempty"`
+	NameServers []string      `json:"nameservers,omitempty"`
+	DNSSEC      bool          `json:"dnssec,omitempty"`
+	Entities    []whoisEntity `json:"entities,omitempty"`
+
+	// Raw and Chain are only set for port-43 WHOIS. Raw is the concatenated
+	// registry and registrar response that was parsed; ParseError is set
+	// when whois-parser could not make sense of it.
+	Raw        string     `json:"raw,omitempty"`
+	Chain      []whoisHop `json:"chain,omitempty"`
+	ParseError string     `json:"parse_error,omitempty"`
+}
+
+// whoisHop is one server in the IANA -> registry -> registrar referral chain.
+type whoisHop struct {
+	Server string `json:"server"`
+	Raw    string `json:"raw"`
+}
+
+type whoisEntity struct {
+	Handle string   `json:"handle,omitempty"`
+	Name   string   `json:"name,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// lookupRegistration tries RDAP first and falls back to port-43 WHOIS.
+func lookupRegistration(ctx context.Context, query string, o options) (whoisResult, error) {
+	// A pinned server or raw output only makes sense for port-43 WHOIS.
+	if !o.noRDAP && o.whoisServer == "" && !o.whoisRaw {
+		res, err := lookupRDAP(ctx, query, o)
+		if err == nil {
+			fillWhoisDates(&res, time.Now())
+			return res, nil
+		}
+		fmt.Fprintf(os.Stderr, "RDAP: %v (fallback naar WHOIS)\n", err)
+	}
+	res, err := lookupWhois(query, o)
+	if err == nil {
+		fillWhoisDates(&res, time.Now())
+	}
+	return res, err
+}
+
+func lookupWhois(query string, o options) (whoisResult, error) {
+	kind, _, _ := rdapQuery(query)
+	res := whoisResult{Query: query, Kind: kind, Source: "whois"}
+
+	chain, err := whoisChain(query, o.whoisServer, o.whoisFollow, o.timeout)
+	if err != nil {
+		return res, err
+	}
+	res.Chain = chain
+
+	// Like the whois package: parse registry and registrar data together,
+	// but leave the IANA bootstrap response out of it.
+	var parts []string
+	for _, hop := range chain {
+		if hop.Server != ianaWhoisServer || len(chain) == 1 {
+			parts = append(parts, hop.Raw)
+		}
+	}
+	res.Raw = strings.Join(parts, "\n")
+	res.Server = chain[len(chain)-1].Server
+
+	parsed, perr := whoisparser.Parse(res.Raw)
+	if perr != nil {
+		res.ParseError = perr.Error()
+		return res, nil
+	}
+	if parsed.Domain == nil {
+		res.ParseError = "geen domein gegevens gevonden"
+		return res, nil
+	}
+
+	// Best-effort fields (parser varies by TLD/registrar).
+	d := parsed.Domain
+	res.Domain = d.Domain
+	res.Status = nonEmpty(d.Status)
+	res.Created = d.CreatedDate
+	res.Updated = d.UpdatedDate
+	res.Expires = d.ExpirationDate
+	res.CreatedAt = d.CreatedDateInTime
+	res.UpdatedAt = d.UpdatedDateInTime
+	res.ExpiresAt = d.ExpirationDateInTime
+	res.NameServers = d.NameServers
+	res.DNSSEC = d.DNSSec
+	if parsed.Registrar != nil {
+		res.Registrar = parsed.Registrar.Name
+	}
+	return res, nil
+}
+
+// runWhois prints the registration data. With -warn-days set it returns
+// false when the domain expires within that many days or has a status
+// that takes it out of the DNS.
+func runWhois(ctx context.Context, query string, o options) (bool, error) {
+	res, err := lookupRegistration(ctx, query, o)
+	if err != nil {
+		return false, err
+	}
+	printWhoisResult(res, o.whoisRaw)
+
+	if o.warnDays <= 0 || res.Kind != "domain" || res.ParseError != "" {
+		return true, nil
+	}
+	warnings, notes := whoisWarnings(res, o.warnDays)
+	fmt.Println()
+	for _, n := range notes {
+		fmt.Printf("info: %s\n", n)
+	}
+	if len(warnings) == 0 {
+		fmt.Printf("OK: verloopt niet binnen %d dagen en geen kritieke status\n", o.warnDays)
+		return true, nil
+	}
+	for _, w := range warnings {
+		fmt.Printf("[!] %s\n", w)
+	}
+	return false, nil
+}
+
+// whoisDateLayouts covers the formats seen in RDAP events and the WHOIS
+// responses that whois-parser does not convert itself.
+var whoisDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02-Jan-2006",
+	"2006.01.02",
+	"02.01.2006",
+	"2006/01/02",
+}
+
+func parseWhoisDate(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	for _, layout := range whoisDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	return nil
+}
+
+func fillWhoisDates(res *whoisResult, now time.Time) {
+	if res.CreatedAt == nil {
+		res.CreatedAt = parseWhoisDate(res.Created)
+	}
+	if res.UpdatedAt == nil {
+		res.UpdatedAt = parseWhoisDate(res.Updated)
+	}
+	if res.ExpiresAt == nil {
+		res.ExpiresAt = parseWhoisDate(res.Expires)
+	}
+	if res.ExpiresAt != nil {
+		// Floor, so a domain that expired hours ago is -1 days, not 0.
+		days := int(math.Floor(res.ExpiresAt.Sub(now).Hours() / 24))
+		res.DaysLeft = &days
+	}
+}
+
+type eppStatus struct {
+	Code     string
+	Meaning  string
+	Critical bool // domain is (about to be) out of the DNS or lost
+}
+
+// eppStatuses explains the EPP status codes of RFC 5731 and RFC 3915.
+// RDAP uses the same set in lower-case words ("client transfer prohibited").
+var eppStatuses = map[string]eppStatus{
+	"ok":                       {"ok", "geen lopende handelingen of restricties", false},
+	"active":                   {"active", "geen lopende handelingen of restricties", false},
+	"inactive":                 {"inactive", "geen nameservers gekoppeld; domein resolvet niet", false},
+	"clienthold":               {"clientHold", "registrar heeft het domein uit de DNS gehaald", true},
+	"serverhold":               {"serverHold", "registry heeft het domein uit de DNS gehaald", true},
+	"clienttransferprohibited": {"clientTransferProhibited", "transfer lock door de registrar", false},
+	"servertransferprohibited": {"serverTransferProhibited", "transfer lock door de registry", false},
+	"clientdeleteprohibited":   {"clientDeleteProhibited", "verwijderen geblokkeerd door de registrar", false},
+	"serverdeleteprohibited":   {"serverDeleteProhibited", "verwijderen geblokkeerd door de registry", false},
+	"clientupdateprohibited":   {"clientUpdateProhibited", "wijzigingen geblokkeerd door de registrar", false},
+	"serverupdateprohibited":   {"serverUpdateProhibited", "wijzigingen geblokkeerd door de registry", false},
+	"clientrenewprohibited":    {"clientRenewProhibited", "verlengen geblokkeerd door de registrar", false},
+	"serverrenewprohibited":    {"serverRenewProhibited", "verlengen geblokkeerd door de registry", false},
+	"pendingcreate":            {"pendingCreate", "registratie wordt nog verwerkt", false},
+	"pendingrenew":             {"pendingRenew", "verlenging wordt verwerkt", false},
+	"pendingtransfer":          {"pendingTransfer", "transfer naar een andere registrar loopt", true},
+	"pendingupdate":            {"pendingUpdate", "wijziging wordt verwerkt", false},
+	"pendingdelete":            {"pendingDelete", "domein wordt binnenkort verwijderd en komt vrij", true},
+	"pendingrestore":           {"pendingRestore", "herstel uit redemption wordt verwerkt", true},
+	"redemptionperiod":         {"redemptionPeriod", "verlopen en verwijderd; alleen nog (duur) te herstellen", true},
+	"addperiod":                {"addPeriod", "grace period na nieuwe registratie", false},
+	"autorenewperiod":          {"autoRenewPeriod", "grace period na automatische verlenging", false},
+	"renewperiod":              {"renewPeriod", "grace period na verlenging", false},
+	"transferperiod":           {"transferPeriod", "grace period na transfer", false},
+}
+
+// normalizeEPPStatus turns "clientHold https://icann.org/epp#clientHold" and
+// "client hold" into the lookup key "clienthold".
+func normalizeEPPStatus(s string) string {
+	var words []string
+	for _, w := range strings.Fields(s) {
+		if strings.HasPrefix(w, "http") || strings.HasPrefix(w, "(") {
+			break
+		}
+		words = append(words, w)
+	}
+	return strings.ToLower(strings.Join(words, ""))
+}
+
+func explainEPPStatus(s string) (eppStatus, bool) {
+	st, ok := eppStatuses[normalizeEPPStatus(s)]
+	return st, ok
+}
+
+// whoisWarnings checks a domain for -warn-days. Warnings fail the run: a
+// known expiry within warnDays or a critical EPP status. Notes do not: an
+// unknown expiry or a missing transfer lock, since registries like .nl and
+// .de publish neither.
+func whoisWarnings(res whoisResult, warnDays int) (warnings, notes []string) {
+	switch {
+	case res.DaysLeft == nil:
+		notes = append(notes, "vervaldatum onbekend of niet te parsen")
+	case *res.DaysLeft < 0:
+		warnings = append(warnings, fmt.Sprintf("domein is %d dag(en) geleden verlopen", -*res.DaysLeft))
+	case *res.DaysLeft <= warnDays:
+		warnings = append(warnings, fmt.Sprintf("domein verloopt over %d dag(en) (drempel %d)", *res.DaysLeft, warnDays))
+	}
+
+	locked := false
+	for _, s := range res.Status {
+		st, ok := explainEPPStatus(s)
+		if !ok {
+			continue
+		}
+		if st.Code == "clientTransferProhibited" || st.Code == "serverTransferProhibited" {
+			locked = true
+		}
+		if st.Critical {
+			warnings = append(warnings, fmt.Sprintf("status %s: %s", st.Code, st.Meaning))
+		}
+	}
+	if !locked {
+		notes = append(notes, "domein is niet transfer locked (geen client/serverTransferProhibited)")
+	}
+	return warnings, notes
+}
+
+func printWhoisResult(res whoisResult, raw bool) {
+	if len(res.Chain) > 1 {
+		servers := make([]string, 0, len(res.Chain))
+		for _, hop := range res.Chain {
+			servers = append(servers, hop.Server)
+		}
+		fmt.Printf("Referral chain: %s\n", strings.Join(servers, " -> "))
+	}
+	if raw {
+		for _, hop := range res.Chain {
+			fmt.Printf("-- %s --\n%s\n\n", hop.Server, strings.TrimSpace(hop.Raw))
+		}
+	}
+	if res.ParseError != "" {
+		// If parsing fails, show raw output.
+		if !raw {
+			fmt.Println(res.Raw)
+		}
+		return
+	}
+
+	fmt.Printf("Bron: %s", res.Source)
+	if res.Server != "" {
+		fmt.Printf(" (%s)", res.Server)
+	}
+	fmt.Println()
+
+	switch res.Kind {
+	case "domain":
+		fmt.Printf("Domain: %s\n", safe(res.Domain))
+	default:
+		fmt.Printf("Handle: %s\n", safe(res.Handle))
+		fmt.Printf("Naam: %s\n", safe(res.Name))
+		fmt.Printf("Range: %s\n", safe(res.Range))
+		fmt.Printf("Land: %s\n", safe(res.Country))
+	}
+	if len(res.Status) == 0 {
+		fmt.Printf("Status: -\n")
+	} else {
+		fmt.Printf("Status:\n")
+		for _, s := range res.Status {
+			if st, ok := explainEPPStatus(s); ok {
+				fmt.Printf("  - %s: %s\n", st.Code, st.Meaning)
+			} else {
+				fmt.Printf("  - %s\n", s)
+			}
+		}
+	}
+	fmt.Printf("Created: %s\n", formatWhoisDate(res.Created, res.CreatedAt))
+	fmt.Printf("Updated: %s\n", formatWhoisDate(res.Updated, res.UpdatedAt))
+	if res.Kind == "domain" {
+		expires := formatWhoisDate(res.Expires, res.ExpiresAt)
+		if res.DaysLeft != nil {
+			if *res.DaysLeft < 0 {
+				expires += fmt.Sprintf(" (verlopen, %d dag(en) geleden)", -*res.DaysLeft)
+			} else {
+				expires += fmt.Sprintf(" (over %d dag(en))", *res.DaysLeft)
+			}
+		}
+		fmt.Printf("Expires: %s\n", expires)
+		fmt.Printf("Registrar: %s\n", safe(res.Registrar))
+	}
+	if len(res.NameServers) > 0 {
+		fmt.Printf("NameServers:\n")
+		for _, ns := range res.NameServers {
+			fmt.Printf("  - %s\n", ns)
+		}
+	}
+	if len(res.Entities) > 0 {
+		fmt.Printf("Entities:\n")
+		for _, e := range res.Entities {
+			fmt.Printf("  - %s [%s] %s\n", safe(e.Name), strings.Join(e.Roles, ","), e.Handle)
+		}
+	}
+}
+
+func formatWhoisDate(raw string, t *time.Time) string {
+	if t != nil {
+		return t.Format("2006-01-02 15:04 MST")
+	}
+	return safe(raw)
+}
+
+// ianaWhoisServer starts the WHOIS chain. It is a variable so tests can
+// point it at a local server.
+var ianaWhoisServer = "whois.iana.org"
+
+// whoisReferralTokens are the fields registries use to point at the next
+// WHOIS server, in order of preference.
+var whoisReferralTokens = []string{
+	"Registrar WHOIS Server:",
+	"whois:",
+	"ReferralServer:",
+	"refer:",
+	"%referral",
+}
+
+// whoisChain queries the WHOIS servers one by one so every hop (and its raw
+// response) is kept. Without a pinned server the chain starts at IANA; with
+// follow set, referrals are followed until they stop or loop.
+func whoisChain(query, server string, follow bool, timeout time.Duration) ([]whoisHop, error) {
+	c := whois.NewClient().SetDisableReferral(true).SetDisableStats(true)
+	if timeout > 0 {
+		c.SetTimeout(timeout * 2)
+	}
+
+	var chain []whoisHop
+	seen := map[string]bool{}
+
+	if server == "" {
+		// IANA knows the registry server for a TLD, IP or ASN.
+		q := query
+		if kind, _, _ := rdapQuery(query); kind == "domain" {
+			labels := strings.Split(query, ".")
+			q = labels[len(labels)-1]
+		}
+		raw, err := whoisQuery(q, ianaWhoisServer, timeout*2)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, whoisHop{Server: ianaWhoisServer, Raw: raw})
+		seen[ianaWhoisServer] = true
+		server = whoisReferral(raw)
+		if server == "" {
+			return chain, nil
+		}
+	}
+
+	for len(chain) < 5 {
+		raw, err := c.Whois(query, server)
+		if err != nil {
+			if len(chain) > 0 && chain[len(chain)-1].Server != ianaWhoisServer {
+				// Registrar unreachable: keep what the registry told us.
+				fmt.Fprintf(os.Stderr, "WHOIS: referral %s mislukt: %v\n", server, err)
+				break
+			}
+			return nil, err
+		}
+		chain = append(chain, whoisHop{Server: server, Raw: raw})
+		seen[strings.ToLower(server)] = true
+
+		if !follow {
+			break
+		}
+		next := whoisReferral(raw)
+		if next == "" || seen[strings.ToLower(next)] {
+			break
+		}
+		server = next
+	}
+	return chain, nil
+}
+
+// whoisQuery sends one query to server (host or host:port, port 43 by
+// default) and returns the response. The IANA hop goes through here: the
+// WHOIS client sends dot-less queries (a bare TLD) to whois.iana.org
+// whatever server it is given.
+func whoisQuery(query, server string, timeout time.Duration) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "43")
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", server, timeout)
+	if err != nil {
+		return "", fmt.Errorf("whois %s: %w", server, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", fmt.Errorf("whois %s: %w", server, err)
+	}
+	b, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	if err != nil && len(b) == 0 {
+		return "", fmt.Errorf("whois %s: %w", server, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// whoisReferral returns the next server (host or host:port) from a response.
+func whoisReferral(raw string) string {
+	for _, token := range whoisReferralTokens {
+		for _, line := range strings.Split(raw, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) < len(token) || !strings.EqualFold(line[:len(token)], token) {
+				continue
+			}
+			v := strings.TrimSpace(line[len(token):])
+			for _, prefix := range []string{"https:", "http:", "whois:", "rwhois:"} {
+				v = strings.TrimPrefix(v, prefix)
+			}
+			v = strings.Trim(v, "/")
+			if i := strings.IndexAny(v, "/ "); i >= 0 {
+				v = v[:i]
+			}
+			if v != "" {
+				return strings.ToLower(v)
+			}
+		}
+	}
+	return ""
+}
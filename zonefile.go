@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// collectZoneRecords turns a report into the records of the zone itself:
+// everything under the domain that was found, plus the mail policy names
+// (_dmarc, DKIM selectors, _smtp._tls, _mta-sts) and the addresses of
+// in-zone MX, NS and SRV targets, which the report only holds as strings.
+func collectZoneRecords(ctx context.Context, client *dns.Client, resolver string, r *dnsReport) []dnsRecord {
+	origin := dns.Fqdn(strings.ToLower(r.Domain))
+	records := makeSnapshot(r).Records
+
+	var extra []queryResult
+	if m := r.Mail; m != nil {
+		if m.DMARC != "" {
+			extra = append(extra, runQuery(ctx, client, resolver, "_dmarc."+r.Domain, dns.TypeTXT))
+		}
+		for _, k := range m.DKIM {
+			extra = append(extra, runQuery(ctx, client, resolver, k.Selector+"._domainkey."+r.Domain, dns.TypeTXT))
+		}
+		if m.TLSRPT != "" {
+			extra = append(extra, runQuery(ctx, client, resolver, "_smtp._tls."+r.Domain, dns.TypeTXT))
+		}
+		if m.MTASTS != "" {
+			extra = append(extra, runQuery(ctx, client, resolver, "_mta-sts."+r.Domain, dns.TypeTXT))
+		}
+	}
+
+	hosts := map[string]bool{}
+	for _, rec := range records {
+		rr, err := rec.RR()
+		if err != nil {
+			continue
+		}
+		var target string
+		switch v := rr.(type) {
+		case *dns.MX:
+			target = v.Mx
+		case *dns.NS:
+			target = v.Ns
+		case *dns.SRV:
+			target = v.Target
+		}
+		target = strings.ToLower(target)
+		if target != "" && target != "." && dns.IsSubDomain(origin, target) {
+			hosts[target] = true
+		}
+	}
+	for _, h := range sortedKeys(hosts) {
+		extra = append(extra, runQuery(ctx, client, resolver, h, dns.TypeA))
+		extra = append(extra, runQuery(ctx, client, resolver, h, dns.TypeAAAA))
+	}
+	if len(extra) > 0 {
+		records = append(records, makeSnapshot(&dnsReport{Domain: r.Domain, Queries: extra}).Records...)
+	}
+
+	seen := map[string]bool{}
+	var out []dnsRecord
+	for _, rec := range records {
+		if !dns.IsSubDomain(origin, rec.Name) || seen[recordKey(rec)] {
+			continue
+		}
+		seen[recordKey(rec)] = true
+		out = append(out, rec)
+	}
+	return out
+}
+
+// writeZoneFile writes records as an RFC 1035 master file. $TTL is the most
+// common TTL, so only the exceptions carry their own. Records are grouped
+// by owner name (apex first, SOA and NS on top) and the owner is only
+// written on the first line of each group.
+func writeZoneFile(w io.Writer, domain string, records []dnsRecord) error {
+	origin := dns.Fqdn(strings.ToLower(domain))
+
+	ttlCount := map[uint32]int{}
+	for _, r := range records {
+		ttlCount[r.TTL]++
+	}
+	var defTTL uint32 = 3600
+	best := 0
+	for ttl, n := range ttlCount {
+		if n > best || (n == best && ttl < defTTL) {
+			defTTL, best = ttl, n
+		}
+	}
+
+	sorted := append([]dnsRecord{}, records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Name != b.Name {
+			if a.Name == origin || b.Name == origin {
+				return a.Name == origin
+			}
+			return zoneNameLess(a.Name, b.Name)
+		}
+		if zoneTypeRank(a.Type) != zoneTypeRank(b.Type) {
+			return zoneTypeRank(a.Type) < zoneTypeRank(b.Type)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Data < b.Data
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; zone %s, geëxporteerd door ultradns %s\n", origin, version)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(bw, "$TTL %d\n", defTTL)
+
+	prev := ""
+	for _, r := range sorted {
+		owner := ""
+		if r.Name != prev {
+			fmt.Fprintln(bw)
+			owner = relativeName(r.Name, origin)
+			prev = r.Name
+		}
+		ttl := ""
+		if r.TTL != defTTL {
+			ttl = fmt.Sprint(r.TTL)
+		}
+		fmt.Fprintf(bw, "%-24s %-6s IN %-6s %s\n", owner, ttl, r.Type, r.Data)
+	}
+	return bw.Flush()
+}
+
+func relativeName(name, origin string) string {
+	if name == origin {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+origin)
+}
+
+// zoneNameLess orders names like a zone is read: by label from the right.
+func zoneNameLess(a, b string) bool {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+	return len(la) < len(lb)
+}
+
+func zoneTypeRank(t string) int {
+	switch t {
+	case "SOA":
+		return 0
+	case "NS":
+		return 1
+	}
+	return 2
+}
+
+// parseZone reads a master file with dns.ZoneParser.
+func parseZone(r io.Reader, origin, file string) ([]dns.RR, error) {
+	zp := dns.NewZoneParser(r, dns.Fqdn(origin), file)
+	var out []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		out = append(out, rr)
+	}
+	return out, zp.Err()
+}
+
+// exportZone writes the zone file for r to path, or to stdout for "-", and
+// parses it back, so a file that would not load elsewhere is caught here.
+func exportZone(ctx context.Context, client *dns.Client, resolver string, r *dnsReport, path string, stdout io.Writer) (int, error) {
+	records := collectZoneRecords(ctx, client, resolver, r)
+	if len(records) == 0 {
+		return 0, fmt.Errorf("geen records om te exporteren")
+	}
+
+	var buf bytes.Buffer
+	if err := writeZoneFile(&buf, r.Domain, records); err != nil {
+		return 0, err
+	}
+	parsed, err := parseZone(bytes.NewReader(buf.Bytes()), r.Domain, path)
+	if err != nil {
+		return 0, fmt.Errorf("zone file parse controle: %w", err)
+	}
+	if len(parsed) != len(records) {
+		return 0, fmt.Errorf("zone file parse controle: %d records geschreven, %d teruggelezen", len(records), len(parsed))
+	}
+
+	if path == "-" {
+		_, err = stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(path, buf.Bytes(), 0o644)
+	}
+	return len(records), err
+}